@@ -0,0 +1,12 @@
+// Package dll holds the native rtdb C connectors. Built with the rtdb_embed tag on
+// linux/amd64, it embeds linux/libtsdb.so into the binary so that the driver can
+// run without the library being installed on the host:
+//
+//	go build -tags rtdb_embed ./...
+package dll
+
+// Libtsdb returns the embedded libtsdb.so, nil when the binary is built without
+// the rtdb_embed tag.
+func Libtsdb() []byte {
+	return libtsdb
+}
@@ -0,0 +1,11 @@
+//go:build rtdb_embed && linux && amd64
+// +build rtdb_embed,linux,amd64
+
+package dll
+
+import (
+	_ "embed"
+)
+
+//go:embed linux/libtsdb.so
+var libtsdb []byte
@@ -0,0 +1,6 @@
+//go:build !rtdb_embed || !linux || !amd64
+// +build !rtdb_embed !linux !amd64
+
+package dll
+
+var libtsdb []byte
@@ -64,18 +64,21 @@ func init() {
 	port = getEnv("RTDB_TEST_PORT", "9000")
 	address = getEnv("RTDB_TEST_ADDRESS", "127.0.0.1:9000")
 	dbname = getEnv("RTDB_TEST_DBNAME", "test_db")
-	dsn = fmt.Sprintf("%s:%s@tcp(%s)/%s?param1=value1&param2=value2", user, password, address, dbname)
-	// _, err := rd.Open(dsn)
-	// if err != nil {
-	// 	panic(err)
-	// }
-	sqlDB, err := sql.Open("rtdb", dsn)
+	// special characters of the password are escaped by FormatDSN
+	config := rtdb.NewConfig()
+	config.User = user
+	config.Password = password
+	config.Address = address
+	config.DBName = dbname
+	dsn = config.FormatDSN()
+	logger := log.New(os.Stdout, "[rtdb] ", log.Ldate|log.Lshortfile|log.Ltime|log.Ldate)
+	connector, err := rtdb.NewConnector(config, rtdb.WithLogger(logger))
 	if err != nil {
 		panic(err)
 	}
 	db = &DBWrapper{
-		db:     sqlDB,
-		logger: log.New(os.Stdout, "[rtdb] ", log.Ldate|log.Lshortfile|log.Ltime|log.Ldate),
+		db:     sql.OpenDB(connector),
+		logger: logger,
 	}
 	sqls := []string{
 		fmt.Sprintf("CREATE DATABASE '%s' IF NOT EXISTS;", dbname),
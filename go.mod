@@ -1,8 +1,15 @@
 module github.com/racetopdb/gortdb
 
-go 1.14
+go 1.17
 
 require (
 	github.com/davecgh/go-spew v1.1.1
 	github.com/smartystreets/goconvey v1.7.2
+	golang.org/x/text v0.13.0
+)
+
+require (
+	github.com/gopherjs/gopherjs v0.0.0-20181017120253-0766667cb4d1 // indirect
+	github.com/jtolds/gls v4.20.0+incompatible // indirect
+	github.com/smartystreets/assertions v1.2.0 // indirect
 )
@@ -0,0 +1,134 @@
+package rtdb
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// nativeBackendName selects the cgo RtdbAdapter with the backend DSN parameter.
+const nativeBackendName = "cgo"
+
+// Backend is the native access layer of a connection. The cgo RtdbAdapter is the
+// default implementation, another one can be registered with RegisterBackend or
+// injected with WithBackend, for example to run the driver without libtsdb.so in tests.
+//
+// A backend is used by one connection at a time and holds at most one result set:
+// Query executes a statement, StoreResult stores its result, FetchFields and
+// FetchOne read it and FreeResult releases it.
+type Backend interface {
+	// Connect logs in to the server.
+	Connect() error
+	// Disconnect logs out of the server.
+	Disconnect() error
+	// IsLogined reports whether the login to the server is alive.
+	IsLogined() bool
+	// Query executes one statement in database db, charset is the character set of sql.
+	Query(sql string, charset string, db string) error
+	// StoreResult stores the result of the last statement and positions the cursor
+	// at its first row. It does nothing when the statement has no result.
+	StoreResult() error
+	// IsResultSetEmpty reports whether no result set is stored.
+	IsResultSetEmpty() bool
+	// AffectedRows returns the number of rows of the stored result set.
+	AffectedRows() uint64
+	// FetchFields returns the columns of the stored result set.
+	FetchFields() []Field
+	// FetchOne returns the row at the cursor and moves the cursor forward, datetime
+	// values are returned as time.Time. It returns io.EOF when all rows have been read.
+	FetchOne() ([]interface{}, error)
+	// ReadDone reports whether all rows of the stored result set have been read.
+	ReadDone() bool
+	// FreeResult releases the stored result set.
+	FreeResult() error
+	// CleanUp releases the backend, it can not be used any more.
+	CleanUp() error
+}
+
+// Reconnector is implemented by a backend which can log in again after a broken
+// connection without closing it, it is used before a statement is retried, see
+// Config.Retries. Other backends are disconnected and connected again.
+type Reconnector interface {
+	// Reconnect logs in to the server again when the login is not alive.
+	Reconnect() error
+}
+
+// Validator is implemented by a backend which knows from its local state whether
+// it is still connected, IsValid and ResetSession of a pooled connection use it.
+// Valid must neither call the server nor wait for other connections. Without it
+// only the state of the connection itself is checked.
+type Validator interface {
+	// Valid reports whether the backend is still connected.
+	Valid() bool
+}
+
+// BackendFactory creates the backend of a new connection.
+type BackendFactory func(cfg *Config) (Backend, error)
+
+var (
+	backendsMu sync.RWMutex
+	backends   = make(map[string]BackendFactory)
+)
+
+// RegisterBackend makes a backend available under name, it is selected with the
+// backend DSN parameter. Without the parameter the native backend is used, or the
+// only registered backend when the driver is built without cgo. RegisterBackend
+// panics when it is called twice with the same name or factory is nil.
+func RegisterBackend(name string, factory BackendFactory) {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+	if factory == nil {
+		panic("rtdb: RegisterBackend factory is nil")
+	}
+	if _, dup := backends[name]; dup || name == nativeBackendName {
+		panic("rtdb: RegisterBackend called twice for backend " + name)
+	}
+	backends[name] = factory
+}
+
+// lookupBackend returns the registered backend name, or the default one when name
+// is empty.
+func lookupBackend(name string) (BackendFactory, error) {
+	backendsMu.RLock()
+	defer backendsMu.RUnlock()
+	if name == nativeBackendName || name == "" && nativeBackend != nil {
+		if nativeBackend == nil {
+			return nil, ErrNativeUnavailable
+		}
+		return nativeBackend, nil
+	}
+	if name != "" {
+		factory, ok := backends[name]
+		if !ok {
+			return nil, fmt.Errorf("rtdb: unknown backend %q", name)
+		}
+		return factory, nil
+	}
+	switch len(backends) {
+	case 0:
+		return nil, ErrNativeUnavailable
+	case 1:
+		for _, factory := range backends {
+			return factory, nil
+		}
+	}
+	names := make([]string, 0, len(backends))
+	for name := range backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return nil, fmt.Errorf("%w, choose one of the registered backends with the backend parameter: %s",
+		ErrNativeUnavailable, strings.Join(names, ", "))
+}
+
+// Option configures a connector.
+type Option func(c *connector)
+
+// WithBackend makes the connections use the backends created by factory instead
+// of the registered ones.
+func WithBackend(factory BackendFactory) Option {
+	return func(c *connector) {
+		c.newBackend = factory
+	}
+}
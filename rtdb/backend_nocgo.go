@@ -0,0 +1,7 @@
+//go:build !cgo
+// +build !cgo
+
+package rtdb
+
+// nativeBackend is the default backend, it is nil when the driver is built without cgo.
+var nativeBackend BackendFactory
@@ -0,0 +1,24 @@
+//go:build !cgo
+// +build !cgo
+
+package rtdb
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// go test -timeout 30s -run ^Test_connector_Connect_withoutCgo$ github.com/racetopdb/gortdb/rtdb -v
+func Test_connector_Connect_withoutCgo(t *testing.T) {
+	Convey("Test_connector_Connect_withoutCgo", t, func(ctx C) {
+		Convey("Connect should report that the native backend is unavailable", func(ctx C) {
+			withBackends(nil, map[string]BackendFactory{}, func() {
+				c := newConnector(&Config{User: "test", Password: "test", Address: "127.0.0.1:9000"})
+				_, err := c.Connect(context.Background())
+				So(err, ShouldEqual, ErrNativeUnavailable)
+			})
+		})
+	})
+}
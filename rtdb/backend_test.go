@@ -0,0 +1,273 @@
+package rtdb
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// fakeResult is the scripted result of one statement of fakeBackend.
+type fakeResult struct {
+	fields []Field
+	rows   [][]interface{}
+	err    error
+}
+
+// fakeBackend is an in-memory Backend which answers statements from a script.
+type fakeBackend struct {
+	results  map[string]fakeResult
+	queries  []string
+	logined  bool
+	cleaned  bool
+	current  *fakeResult
+	executed string
+	cursor   int
+}
+
+func (b *fakeBackend) Connect() error    { b.logined = true; return nil }
+func (b *fakeBackend) Disconnect() error { b.logined = false; return nil }
+func (b *fakeBackend) IsLogined() bool   { return b.logined }
+func (b *fakeBackend) Valid() bool       { return b.logined }
+
+func (b *fakeBackend) Query(sql string, charset string, db string) error {
+	b.queries = append(b.queries, sql)
+	b.executed = sql
+	return b.results[sql].err
+}
+
+func (b *fakeBackend) StoreResult() error {
+	b.current, b.cursor = nil, 0
+	if res, ok := b.results[b.executed]; ok && res.fields != nil {
+		b.current = &res
+	}
+	return nil
+}
+
+func (b *fakeBackend) IsResultSetEmpty() bool { return b.current == nil }
+
+func (b *fakeBackend) AffectedRows() uint64 {
+	if b.current == nil {
+		return 0
+	}
+	return uint64(len(b.current.rows))
+}
+
+func (b *fakeBackend) FetchFields() []Field { return b.current.fields }
+
+func (b *fakeBackend) FetchOne() ([]interface{}, error) {
+	if b.ReadDone() {
+		return nil, io.EOF
+	}
+	b.cursor++
+	return b.current.rows[b.cursor-1], nil
+}
+
+func (b *fakeBackend) ReadDone() bool {
+	return b.current == nil || b.cursor >= len(b.current.rows)
+}
+
+func (b *fakeBackend) FreeResult() error { b.current = nil; return nil }
+func (b *fakeBackend) CleanUp() error    { b.cleaned = true; return nil }
+
+// go test -timeout 30s -run ^TestWithBackend$ github.com/racetopdb/gortdb/rtdb -v
+func TestWithBackend(t *testing.T) {
+	Convey("TestWithBackend", t, func(ctx C) {
+		at := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+		backend := &fakeBackend{results: map[string]fakeResult{
+			pingQuery: {},
+			"select name, time from t where id = 1": {
+				fields: []Field{
+					{Name: "name", Type: FieldTypeString},
+					{Name: "time", Type: FieldTypeDatetime, Nullable: true},
+				},
+				rows: [][]interface{}{{"a", at}, {"b", nil}},
+			},
+			"insert into t(id) values(1)": {},
+			"select * from missing":       {err: errors.New("table not found")},
+		}}
+		connector, err := NewDriver(WithBackend(func(cfg *Config) (Backend, error) {
+			return backend, nil
+		})).OpenConnector("test:test@tcp(127.0.0.1:9000)/?loc=UTC")
+		So(err, ShouldBeNil)
+		db := sql.OpenDB(connector)
+		defer db.Close()
+
+		Convey("Queries should be answered by the injected backend", func(ctx C) {
+			rows, err := db.Query("select name, time from t where id = ?", 1)
+			So(err, ShouldBeNil)
+			defer rows.Close()
+			So(backend.logined, ShouldBeTrue)
+
+			var (
+				name string
+				tm   sql.NullTime
+			)
+			So(rows.Next(), ShouldBeTrue)
+			So(rows.Scan(&name, &tm), ShouldBeNil)
+			So(name, ShouldEqual, "a")
+			So(tm.Valid, ShouldBeTrue)
+			So(tm.Time.Equal(at), ShouldBeTrue)
+			So(rows.Next(), ShouldBeTrue)
+			So(rows.Scan(&name, &tm), ShouldBeNil)
+			So(name, ShouldEqual, "b")
+			So(tm.Valid, ShouldBeFalse)
+			So(rows.Next(), ShouldBeFalse)
+			So(rows.Err(), ShouldBeNil)
+		})
+
+		Convey("Statements without a result set should return empty rows", func(ctx C) {
+			rows, err := db.Query("insert into t(id) values(1)")
+			So(err, ShouldBeNil)
+			So(rows.Next(), ShouldBeFalse)
+			So(rows.Close(), ShouldBeNil)
+
+			_, err = db.Exec("insert into t(id) values(?)", 1)
+			So(err, ShouldBeNil)
+			So(backend.queries[len(backend.queries)-1], ShouldEqual, "insert into t(id) values(1)")
+		})
+
+		Convey("Backend errors should be returned to the caller", func(ctx C) {
+			_, err := db.Query("select * from missing")
+			So(err, ShouldBeError, "table not found")
+		})
+
+		Convey("Closing the connection should clean up the backend", func(ctx C) {
+			conn, err := connector.Connect(context.Background())
+			So(err, ShouldBeNil)
+			So(conn.Close(), ShouldBeNil)
+			So(backend.cleaned, ShouldBeTrue)
+		})
+	})
+}
+
+// bufferLogger is a Logger collecting the messages.
+type bufferLogger struct {
+	messages []string
+}
+
+func (l *bufferLogger) Printf(format string, v ...interface{}) {
+	l.messages = append(l.messages, fmt.Sprintf(format, v...))
+}
+
+// go test -timeout 30s -run ^TestNewConnector$ github.com/racetopdb/gortdb/rtdb -v
+func TestNewConnector(t *testing.T) {
+	Convey("TestNewConnector", t, func(ctx C) {
+		backend := &fakeBackend{results: map[string]fakeResult{pingQuery: {}}}
+		logger := &bufferLogger{}
+		var attempts int
+		config := NewConfig()
+		config.Password = "p@ss"
+		connector, err := NewConnector(config,
+			WithBackend(func(cfg *Config) (Backend, error) {
+				So(cfg.Password, ShouldEqual, "p@ss")
+				return backend, nil
+			}),
+			WithHooks(Hooks{BeforeAttempt: func(a Attempt) { attempts++ }}),
+			WithLogger(logger),
+		)
+		So(err, ShouldBeNil)
+		// the connector keeps its own copy
+		config.Password = ""
+
+		db := sql.OpenDB(connector)
+		defer db.Close()
+		backend.results["select * from missing"] = fakeResult{err: InvalidArgs}
+		_, err = db.Query("select * from missing")
+		So(err, ShouldEqual, InvalidArgs)
+		So(attempts, ShouldEqual, 1)
+		So(logger.messages, ShouldResemble, []string{InvalidArgs.Error()})
+
+		Convey("An invalid Config should be rejected", func(ctx C) {
+			_, err := NewConnector(nil)
+			So(errors.Is(err, InvalidDSN), ShouldBeTrue)
+			config := NewConfig()
+			config.HostPolicy = "first"
+			_, err = NewConnector(config)
+			var perr *ParseError
+			So(errors.As(err, &perr), ShouldBeTrue)
+			So(perr.Part, ShouldEqual, "hostPolicy")
+		})
+	})
+}
+
+// withBackends runs f with the native backend and the registry of backends replaced.
+func withBackends(native BackendFactory, m map[string]BackendFactory, f func()) {
+	backendsMu.Lock()
+	savedNative, saved := nativeBackend, backends
+	nativeBackend, backends = native, m
+	backendsMu.Unlock()
+	defer func() {
+		backendsMu.Lock()
+		nativeBackend, backends = savedNative, saved
+		backendsMu.Unlock()
+	}()
+	f()
+}
+
+// go test -timeout 30s -run ^TestRegisterBackend$ github.com/racetopdb/gortdb/rtdb -v
+func TestRegisterBackend(t *testing.T) {
+	Convey("TestRegisterBackend", t, func(ctx C) {
+		fake := &fakeBackend{results: map[string]fakeResult{pingQuery: {}}}
+		factory := func(cfg *Config) (Backend, error) {
+			return fake, nil
+		}
+
+		Convey("The backend parameter should select a registered backend", func(ctx C) {
+			withBackends(nativeBackend, map[string]BackendFactory{}, func() {
+				RegisterBackend("fake", factory)
+				So(func() { RegisterBackend("fake", factory) }, ShouldPanic)
+
+				config, err := ParseDSN("test:test@tcp(127.0.0.1:9000)/?backend=fake")
+				So(err, ShouldBeNil)
+				So(config.Backend, ShouldEqual, "fake")
+				conn, err := newConnector(config).Connect(context.Background())
+				So(err, ShouldBeNil)
+				So(fake.logined, ShouldBeTrue)
+				So(conn.Close(), ShouldBeNil)
+
+				config.Backend = "missing"
+				_, err = newConnector(config).Connect(context.Background())
+				So(err, ShouldBeError, `rtdb: unknown backend "missing"`)
+			})
+		})
+
+		Convey("Without the native backend the only registered one should be the default", func(ctx C) {
+			withBackends(nil, map[string]BackendFactory{"fake": factory}, func() {
+				_, err := lookupBackend("")
+				So(err, ShouldBeNil)
+			})
+			withBackends(nil, map[string]BackendFactory{"fake": factory, "other": factory}, func() {
+				_, err := lookupBackend("")
+				So(errors.Is(err, ErrNativeUnavailable), ShouldBeTrue)
+			})
+			withBackends(nil, map[string]BackendFactory{}, func() {
+				_, err := lookupBackend("")
+				So(err, ShouldEqual, ErrNativeUnavailable)
+			})
+		})
+	})
+}
+
+// go test -timeout 30s -run ^Test_logf$ github.com/racetopdb/gortdb/rtdb -v
+func Test_logf(t *testing.T) {
+	Convey("Test_logf", t, func(ctx C) {
+		var buf bytes.Buffer
+		rtdbLogger.SetOutput(&buf)
+		defer rtdbLogger.SetOutput(os.Stdout)
+		(&rtdbConn{}).logf("from the connection")
+		So(buf.String(), ShouldContainSubstring, "backend_test.go:")
+		So(buf.String(), ShouldContainSubstring, "from the connection")
+		buf.Reset()
+		(&connector{}).logf("from the connector")
+		So(buf.String(), ShouldContainSubstring, "backend_test.go:")
+		So(buf.String(), ShouldContainSubstring, "from the connector")
+	})
+}
@@ -1,38 +1,28 @@
+//go:build cgo
+// +build cgo
+
 package rtdb
 
 //
 //#cgo LDFLAGS: -Wl,--allow-multiple-definition
-//#cgo linux LDFLAGS: -L${SRCDIR}/../dll/linux -ltsdb
+//#cgo linux LDFLAGS: -ldl
 //#cgo linux CFLAGS: -I${SRCDIR}/../include
 //#include "stdio.h"
 //#include "stdlib.h"
-//#include "tsdb_ml.h"
+//#include "tsdb_dl.h"
 import "C"
 
-// 使用系统安装路径
-//#cgo linux CFLAGS: -I/usr/local/tsdb/include
-//#cgo linux LDFLAGS: -L/usr/lib -ltsdb
-
-// 使用本地绝对路径
-//#cgo LDFLAGS: -L/home/pengzhao/rtdb/source/plugin/dynamiclib/linux -ltsdb
-//#cgo linux CFLAGS: -I/home/pengzhao/rtdb/source/plugin/include
-
-// 使用相对路径
-// 这里查资料的时候理解错了，不管是库文件检索目录还是头文件检索目录都可以使用${SRCDIR}表示当前文件的绝对路径，然后再做相对路径的处理
-//#cgo linux LDFLAGS: -L${SRCDIR}/../../dynamiclib/linux -ltsdb
-//#cgo linux CFLAGS: -I${SRCDIR}/../../include
-
-// 使用相对路径
-// 在go项目内部的路径
-//#cgo linux LDFLAGS: -L${SRCDIR}/../dll/linux -ltsdb
-//#cgo linux CFLAGS: -I${SRCDIR}/../include
-
-// export LD_LIBRARY_PATH=/home/pengzhao/rtdb/source/plugin/dynamiclib/linux
+// libtsdb.so is not linked at build time, it is opened with dlopen when the first
+// connection is created, see library.go. The tsdb_* functions are called through
+// the gortdb_tsdb_* functions of tsdb_dl.c.
 
 import (
 	"database/sql/driver"
 	"fmt"
 	"io"
+	"net"
+	"runtime"
+	"strconv"
 	"time"
 	"unsafe"
 )
@@ -58,29 +48,107 @@ type Row C.tsdb_row_t
 
 type RtdbAdapter struct {
 	dllPath      string
-	connStr      string
+	connStr      string // connection string, dropped once the login is registered
+	session      string // key of the login in nativeSessions, see sessionKey
+	target       string // connection string with the password redacted
 	rtdbClient   unsafe.Pointer
 	charset      string
 	result       unsafe.Pointer
-	fields       []rtdbField
+	fields       []Field
 	affectedRows uint64
 	insertId     uint64
 	cursor       RowsPtr // current row cursor, when read no rows, cursor will be nil.
 	status       AtomicInt16
+	resultBytes  int64  // estimated size of the stored result set
+	err          error  // set when libtsdb could not be loaded
+	release      func() // releases the session held from the query until the result is stored
 }
 
+// NewRtdbAdapter allocates a native client. The client is released by CleanUp, a
+// finalizer releases it when the adapter is garbage collected without CleanUp.
+// libtsdb is loaded from RTDB_LIB_PATH or the standard locations.
 func NewRtdbAdapter(host string, port int, user string, password string) *RtdbAdapter {
-	a := &RtdbAdapter{}
+	return newRtdbAdapter("", host, port, user, password)
+}
+
+// newRtdbAdapter allocates a native client of the libtsdb at dllPath, which may
+// be empty to search the library.
+func newRtdbAdapter(dllPath string, host string, port int, user string, password string) *RtdbAdapter {
+	a := &RtdbAdapter{dllPath: dllPath}
+	a.init(host, port, user, password)
+	runtime.SetFinalizer(a, (*RtdbAdapter).finalize)
+	return a
+}
+
+func (a *RtdbAdapter) init(host string, port int, user string, password string) {
 	a.connStr = buildConnStr(host, port, user, password)
+	a.target = redactSecrets(a.connStr)
+	if a.err = loadLibrary(a.dllPath); a.err != nil {
+		rtdbLogger.Printf("load libtsdb failed, err: %v", a.err)
+		return
+	}
 
-	rtdbClient := unsafe.Pointer(C.tsdb_new())
+	rtdbClient := unsafe.Pointer(C.gortdb_tsdb_new())
 	a.rtdbClient = rtdbClient
+	if rtdbClient != nil {
+		trackClient()
+	}
 	a.charset = a.getCharset()
-	return a
 }
 
+// finalize is the safety net for adapters which are never cleaned up.
+func (a *RtdbAdapter) finalize() {
+	if a.rtdbClient == nil {
+		return
+	}
+	rtdbLogger.Printf("rtdb client is garbage collected without clean up, releasing it")
+	if a.isConnected() {
+		if err := a.CgoDisconnect(); err != nil {
+			rtdbLogger.Printf("disconnect failed, err: %v", err)
+		}
+	}
+	if err := a.CleanUp(); err != nil {
+		rtdbLogger.Printf("clean up failed, err: %v", err)
+	}
+}
+
+// nativeBackend is the default backend, it is nil when the driver is built without cgo.
+var nativeBackend BackendFactory = newCgoBackend
+
+// newCgoBackend is the BackendFactory of the native backend, it allocates a client of libtsdb.
+func newCgoBackend(cfg *Config) (Backend, error) {
+	if cfg.TLS != nil {
+		// never fall back to a plain text link when TLS is required
+		if err := loadLibrary(cfg.LibPath); err != nil {
+			return nil, err
+		}
+		return nil, tlsUnsupported()
+	}
+	host, port := cfg.HostAndPort()
+	a := newRtdbAdapter(cfg.LibPath, host, port, cfg.User, cfg.Password)
+	if a.err != nil {
+		return nil, a.err
+	}
+	return a, nil
+}
+
+// String describes the adapter, the password of the connection string is redacted.
+func (a *RtdbAdapter) String() string {
+	return "RtdbAdapter(" + a.target + ")"
+}
+
+// GoString is String, so that %#v does not print the password either.
+func (a *RtdbAdapter) GoString() string {
+	return a.String()
+}
+
+// buildConnStr returns the connection string of libtsdb. Its parser knows the
+// keys user, passwd, servers and server only: query_send_timeout_ms,
+// admin_recv_timeout_ms and admin_send_timeout_ms occur in libtsdb.so as names of
+// internal variables of its debug information, not as keys, so no timeout is
+// passed and the timeouts of Config are enforced by the driver, see TimeoutError.
 func buildConnStr(host string, port int, user string, password string) string {
-	return fmt.Sprintf("user=%s;passwd=%s;servers=tcp://%s:%d", user, password, host, port)
+	return fmt.Sprintf("user=%s;passwd=%s;servers=tcp://%s", user, password, net.JoinHostPort(host, strconv.Itoa(port)))
 }
 
 func (a *RtdbAdapter) getStatus() int16 {
@@ -99,17 +167,38 @@ func (a *RtdbAdapter) isConnected() bool {
 	return a.getStatus() >= rtdbAdapterStatusConnected
 }
 
+// nativeSessions binds the process wide login of libtsdb to the connection string
+// of the adapter which is calling into it.
+var nativeSessions = newSessionManager(
+	func(connStr string) error {
+		cConnStr := C.CString(connStr)
+		defer C.free(unsafe.Pointer(cConnStr))
+		return newError(opConnect, int(C.gortdb_tsdb_connect(cConnStr)), "")
+	},
+	func() error {
+		return newError(opDisconnect, int(C.gortdb_tsdb_disconnect()), "")
+	},
+)
+
 // CgoConnect 使用Cgo调用C函数进行数据库连接
 func (a *RtdbAdapter) CgoConnect() error {
 	if a.isConnected() {
 		rtdbLogger.Printf("Connection is not allowed in the current state, current state: %d\n", a.getStatus())
 		return nil
 	}
-	cConnStr := C.CString(a.connStr)
-	defer C.free(unsafe.Pointer(cConnStr))
-	if err := convertErr(int(C.tsdb_connect(cConnStr))); err != nil {
+	if a.err != nil {
+		return a.err
+	}
+	if a.connStr == "" {
+		// the password has been dropped by the first connect
+		return InvalidConn
+	}
+	session, err := nativeSessions.open(a.connStr)
+	if err != nil {
 		return err
 	}
+	// the session manager keeps the connection string while the login is used
+	a.session, a.connStr = session, ""
 	a.setStatus(rtdbAdapterStatusConnected)
 	return nil
 }
@@ -120,13 +209,33 @@ func (a *RtdbAdapter) CgoDisconnect() error {
 		rtdbLogger.Printf("Connection destruction is not allowed in the current state, current state: %d\n", a.getStatus())
 		return nil
 	}
-	if err := convertErr(int(C.tsdb_disconnect())); err != nil {
+	a.setStatus(rtdbAdapterStatusDisconnect)
+	if err := a.CgoFreeResult(); err != nil {
+		rtdbLogger.Printf("free result before disconnect failed, err: %v", err)
+	}
+	if err := nativeSessions.close(a.session); err != nil {
 		return err
 	}
-	a.setStatus(rtdbAdapterStatusDisconnect)
 	return nil
 }
 
+// CgoIsLogined 使用Cgo调用C函数检查当前是否已经登录数据库
+func (a *RtdbAdapter) CgoIsLogined() bool {
+	return nativeSessions.logined(a.session, func() bool {
+		return C.gortdb_tsdb_is_logined() != 0
+	})
+}
+
+// CgoReconnect 使用Cgo调用C函数重新登录数据库，共享的登录不会被释放
+func (a *RtdbAdapter) CgoReconnect() error {
+	if !a.isConnected() {
+		return a.CgoConnect()
+	}
+	return nativeSessions.relogin(a.session, func() bool {
+		return C.gortdb_tsdb_is_logined() != 0
+	})
+}
+
 // CgoQuery 使用Cgo调用C函数执行一条数据库查询
 func (a *RtdbAdapter) CgoQuery(sql string, charset string, db string) error {
 	var charsetin string
@@ -139,25 +248,52 @@ func (a *RtdbAdapter) CgoQuery(sql string, charset string, db string) error {
 		charsetin = a.charset
 	}
 
+	if a.rtdbClient == nil {
+		if a.err != nil {
+			return a.err
+		}
+		return InvalidConn
+	}
+
 	cSql := C.CString(sql)
 	cCharset := C.CString(charsetin)
 	cDb := C.CString(db)
 	defer C.free(unsafe.Pointer(cSql))
 	defer C.free(unsafe.Pointer(cCharset))
 	defer C.free(unsafe.Pointer(cDb))
-	errCode := int(C.tsdb_query(a.rtdbClient, cSql, C.int(len(sql)), cCharset, cDb))
-	if err := convertErr(errCode); err != nil {
+	a.fields = nil
+	// the session is held until the result is stored, so that the login can not be
+	// re-bound in between
+	if a.release == nil {
+		release, err := nativeSessions.acquire(a.session)
+		if err != nil {
+			return err
+		}
+		a.release = release
+	}
+	errCode := int(C.gortdb_tsdb_query(a.rtdbClient, cSql, C.int(len(sql)), cCharset, cDb))
+	if err := newError(opQuery, errCode, sql); err != nil {
+		a.releaseSession()
 		return err
 	}
 	return nil
 }
 
+// releaseSession releases the session acquired by CgoQuery, a stored result set
+// and its fields do not need the login.
+func (a *RtdbAdapter) releaseSession() {
+	if a.release != nil {
+		a.release()
+		a.release = nil
+	}
+}
+
 func (a *RtdbAdapter) close() error {
 	return a.CgoDisconnect()
 }
 
 func (a *RtdbAdapter) getCharset() string {
-	cCharset := C.tsdb_charset_get()
+	cCharset := C.gortdb_tsdb_charset_get()
 	charset := C.GoString(cCharset)
 
 	return charset
@@ -169,16 +305,54 @@ func (a *RtdbAdapter) readDone() bool {
 
 // CgoStoreResult 使用Cgo调用C函数获取查询的结果集
 func (a *RtdbAdapter) CgoStoreResult() error {
-	result := C.tsdb_store_result_v2(a.rtdbClient)
-	if result != nil {
-		a.result = unsafe.Pointer(result)
+	defer a.releaseSession()
+	if err := a.freeResult(); err != nil {
+		return err
 	}
+	result := C.gortdb_tsdb_store_result_v2(a.rtdbClient)
+	if result == nil {
+		return nil
+	}
+	a.setResult(ResultSetPtr(result))
+	a.FetchFields()
 	return nil
 }
 
-// CgoFreeResult 使用Cgo调用C函数释放查询结果集的内存
+// setResult keeps the stored result set and accounts for its native memory.
+func (a *RtdbAdapter) setResult(result ResultSetPtr) {
+	a.result = unsafe.Pointer(result)
+	a.resultBytes = resultSetBytes(result)
+	trackResult(a.resultBytes)
+}
+
+// resultSetBytes estimates the native memory held by a result set.
+func resultSetBytes(result ResultSetPtr) int64 {
+	fieldCount := int64((*result).field_count)
+	bytes := int64(unsafe.Sizeof(*result)) + fieldCount*int64(VOID_POINTER_SIZE)
+	for rows := (*result).data; rows != nil; rows = rows.next {
+		bytes += int64(unsafe.Sizeof(*rows)) + fieldCount*int64(VOID_POINTER_SIZE) + int64(rows.len)
+	}
+	return bytes
+}
+
+// CgoFreeResult 使用Cgo调用C函数释放查询结果集的内存, and releases the session
+// of a query whose result has not been stored.
 func (a *RtdbAdapter) CgoFreeResult() error {
-	if err := convertErr(int(C.tsdb_free_result(a.rtdbClient, a.result))); err != nil {
+	defer a.releaseSession()
+	return a.freeResult()
+}
+
+// freeResult frees the stored result set, the session is kept.
+func (a *RtdbAdapter) freeResult() error {
+	if a.result == nil || a.rtdbClient == nil {
+		return nil
+	}
+	result := a.result
+	a.result = nil
+	a.cursor = nil
+	untrackResult(a.resultBytes)
+	a.resultBytes = 0
+	if err := newError(opFree, int(C.gortdb_tsdb_free_result(a.rtdbClient, result)), ""); err != nil {
 		return err
 	}
 	return nil
@@ -189,11 +363,9 @@ func (a *RtdbAdapter) CleanUp() error {
 	if a.rtdbClient == nil {
 		return nil
 	}
-	if a.result != nil {
-		// free result set
-		if err := a.CgoFreeResult(); err != nil {
-			return err
-		}
+	// free result set
+	if err := a.CgoFreeResult(); err != nil {
+		return err
 	}
 
 	if err := a.CgoKillMe(); err != nil {
@@ -204,40 +376,45 @@ func (a *RtdbAdapter) CleanUp() error {
 }
 
 func (a *RtdbAdapter) CgoKillMe() error {
-	C.tsdb_kill_me(a.rtdbClient)
+	if a.rtdbClient == nil {
+		return nil
+	}
+	C.gortdb_tsdb_kill_me(a.rtdbClient)
+	a.rtdbClient = nil
+	untrackClient()
 	return nil
 }
 
 // FetchFields 获取数据库列的信息
-func (a *RtdbAdapter) FetchFields() []rtdbField {
+func (a *RtdbAdapter) FetchFields() []Field {
 	if len(a.fields) > 0 {
 		return a.fields
 	}
 	var (
 		f        *C.tsdb_ml_field_t
 		i        int
-		fields   []rtdbField
+		fields   []Field
 		fieldArr **C.tsdb_ml_field_t
 	)
 	fieldCount := C.int(0)
-	fieldArr = C.tsdb_fetch_ml_fields(a.rtdbClient, &fieldCount)
+	fieldArr = C.gortdb_tsdb_fetch_ml_fields(a.rtdbClient, &fieldCount)
 	if unsafe.Pointer(fieldArr) == nil || int(fieldCount) <= 0 {
 		return nil
 	}
 	for i = 0; i < int(fieldCount); i++ {
-		field := rtdbField{}
+		field := Field{}
 		f = *(*MrFieldPtr)(unsafe.Pointer(uintptr(unsafe.Pointer(fieldArr)) + (unsafe.Sizeof(f) * uintptr(i))))
 		if unsafe.Pointer(f) == nil || f == nil {
 			break
 		}
 		name := C.GoString((*f).name)
-		field.name = name
-		field.fieldType = fieldType((*f).data_type)
+		field.Name = name
+		field.Type = FieldType((*f).data_type)
 		if uint8((*f).is_null) == 1 {
-			field.isNull = true
+			field.Nullable = true
 		}
-		field.len = uint8((*f).length)
-		field.varLen = uint8((*f).real_length)
+		field.Length = uint8((*f).length)
+		field.RealLength = uint8((*f).real_length)
 		fields = append(fields, field)
 	}
 	a.fields = fields
@@ -250,19 +427,26 @@ func (a *RtdbAdapter) ScanResult() error {
 		rows   RowsPtr
 	)
 
-	result = C.tsdb_store_result_v2(a.rtdbClient)
+	// the stored result set and its fields are read without the login
+	defer a.releaseSession()
+	if err := a.freeResult(); err != nil {
+		return err
+	}
+	result = C.gortdb_tsdb_store_result_v2(a.rtdbClient)
 	if unsafe.Pointer(result) == nil {
-		// rtdbLogger.Printf("store result failed")
-		// return NullPointer
 		return nil
 	}
 	a.setStatus(rtdbAdapterStatusFetchingResult)
 	rowCount := uint64((*result).row_count)
-	a.result = unsafe.Pointer(result)
+	a.setResult(result)
+	a.FetchFields()
 	a.affectedRows = rowCount
 	if rowCount > 0 {
 		rows = (*result).data
 		a.cursor = rows
+	} else {
+		a.cursor = nil
+		a.setStatus(rtdbAdapterStatusEOF)
 	}
 	return nil
 }
@@ -290,36 +474,44 @@ func (a *RtdbAdapter) FetchOne() (values []interface{}, err error) {
 	fields := a.fields
 	row = Row((*a.cursor).row)
 	for i = 0; i < fieldCount; i++ {
-		fieldType := fields[i].fieldType
-		switch fieldType {
-		case fieldTypeUnknown:
-			rtdbLogger.Printf("get fieldType is unknown, fieldIndex: %d, fieldName: %s", i, fields[i].name)
+		cell := *(*unsafe.Pointer)(unsafe.Pointer(uintptr(unsafe.Pointer(row)) + (VOID_POINTER_SIZE * uintptr(i))))
+		if cell == nil {
+			values = append(values, nil)
 			continue
-
-		case fieldTypeString:
-			cString := *(**C.char)(unsafe.Pointer(uintptr(unsafe.Pointer(row)) + (VOID_POINTER_SIZE * uintptr(i))))
-			value = C.GoString(cString)
-		case fieldTypeInt64:
-			value = int64(*(*(**C.int64_t)(unsafe.Pointer(uintptr(unsafe.Pointer(row)) + (VOID_POINTER_SIZE * uintptr(i))))))
-		case fieldTypeInt:
-			value = int32(*(*(**C.int)(unsafe.Pointer(uintptr(unsafe.Pointer(row)) + (VOID_POINTER_SIZE * uintptr(i))))))
-		case fieldTypeDouble:
-			value = float64(*(*(**C.double)(unsafe.Pointer(uintptr(unsafe.Pointer(row)) + (VOID_POINTER_SIZE * uintptr(i))))))
-		case fieldTypeFloat:
-			value = float32(*(*(**C.float)(unsafe.Pointer(uintptr(unsafe.Pointer(row)) + (VOID_POINTER_SIZE * uintptr(i))))))
-		case fieldTypeBinary:
-			// TODO: handle binary field type
-		case fieldTypeBool:
-			tmp := byte(*(*(**C.byte_t)(unsafe.Pointer(uintptr(unsafe.Pointer(row)) + (VOID_POINTER_SIZE * uintptr(i))))))
+		}
+		fieldType := fields[i].Type
+		switch fieldType {
+		case FieldTypeUnknown:
+			rtdbLogger.Printf("get fieldType is unknown, fieldIndex: %d, fieldName: %s", i, fields[i].Name)
+			value = nil
+		case FieldTypeString:
+			value = C.GoString((*C.char)(cell))
+		case FieldTypeInt64:
+			value = int64(*(*C.int64_t)(cell))
+		case FieldTypeInt:
+			value = int32(*(*C.int)(cell))
+		case FieldTypeDouble:
+			value = float64(*(*C.double)(cell))
+		case FieldTypeFloat:
+			value = float32(*(*C.float)(cell))
+		case FieldTypeBinary:
+			n, err := fields[i].binaryLen()
+			if err != nil {
+				return nil, fmt.Errorf("%w, column: %s", err, fields[i].Name)
+			}
+			value = C.GoBytes(cell, C.int(n))
+		case FieldTypeBool:
+			tmp := byte(*(*C.byte_t)(cell))
 			if tmp == 1 {
 				value = true
 			} else {
 				value = false
 			}
-		case fieldTypeDatetime:
-			v := int64(*(*(**C.int64_t)(unsafe.Pointer(uintptr(unsafe.Pointer(row)) + (VOID_POINTER_SIZE * uintptr(i))))))
-			value = time.Unix(v/1000, 0)
-		case fieldTypeNull:
+		case FieldTypeDatetime:
+			v := int64(*(*C.int64_t)(cell))
+			// datetime is stored as epoch milliseconds
+			value = time.Unix(v/1000, (v%1000)*int64(time.Millisecond)).UTC()
+		case FieldTypeNull:
 			value = nil
 		}
 		values = append(values, value)
@@ -331,20 +523,52 @@ func (a *RtdbAdapter) FetchOne() (values []interface{}, err error) {
 	return
 }
 
-func convertErr(errCode int) error {
-	noErrCode := 0
-	switch errCode {
-	case noErrCode:
-		return nil
-	case EINVAL:
-		return InvalidArgs
-	case EACCES:
-		return NoAccess
-	case ENOMEM:
-		return OutOfMemory
-	case EPROTO:
-		return ProtocolError
-	default:
-		return ProtocolError
-	}
+// Connect implements Backend.
+func (a *RtdbAdapter) Connect() error {
+	return a.CgoConnect()
+}
+
+// Disconnect implements Backend.
+func (a *RtdbAdapter) Disconnect() error {
+	return a.CgoDisconnect()
+}
+
+// Reconnect implements Reconnector.
+func (a *RtdbAdapter) Reconnect() error {
+	return a.CgoReconnect()
+}
+
+// IsLogined implements Backend.
+func (a *RtdbAdapter) IsLogined() bool {
+	return a.CgoIsLogined()
+}
+
+// Valid implements Validator, it only checks the state of the adapter.
+func (a *RtdbAdapter) Valid() bool {
+	return a.rtdbClient != nil && a.isConnected()
+}
+
+// Query implements Backend.
+func (a *RtdbAdapter) Query(sql string, charset string, db string) error {
+	return a.CgoQuery(sql, charset, db)
+}
+
+// StoreResult implements Backend.
+func (a *RtdbAdapter) StoreResult() error {
+	return a.ScanResult()
+}
+
+// AffectedRows implements Backend.
+func (a *RtdbAdapter) AffectedRows() uint64 {
+	return a.affectedRows
+}
+
+// ReadDone implements Backend.
+func (a *RtdbAdapter) ReadDone() bool {
+	return a.readDone()
+}
+
+// FreeResult implements Backend.
+func (a *RtdbAdapter) FreeResult() error {
+	return a.CgoFreeResult()
 }
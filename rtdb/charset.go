@@ -0,0 +1,110 @@
+package rtdb
+
+import (
+	"errors"
+	"fmt"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/korean"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/traditionalchinese"
+)
+
+// charsetEncodings are the encodings of the charsets whose SQL and STRING columns
+// are converted from and to UTF-8 by the driver. utf-8 needs no conversion, the
+// default iso-8859-1 passes the bytes of Go strings through unchanged as it always
+// did, and ucs-2 strings can not be carried by the NUL terminated C strings.
+var charsetEncodings = map[string]encoding.Encoding{
+	"gbk":          simplifiedchinese.GBK,
+	"big-5":        traditionalchinese.Big5,
+	"euc-jp":       japanese.EUCJP,
+	"shift-jis":    japanese.ShiftJIS,
+	"euc-kr":       korean.EUCKR,
+	"windows-1251": charmap.Windows1251,
+	"windows-1252": charmap.Windows1252,
+}
+
+// encoding returns the encoding strings are converted to, nil when they are sent
+// and returned as they are.
+func (rc *rtdbConn) encoding() encoding.Encoding {
+	if rc.config == nil || rc.config.RawStrings {
+		return nil
+	}
+	return charsetEncodings[rc.config.Charset]
+}
+
+// encodeSQL converts query from UTF-8 to Config.Charset.
+func (rc *rtdbConn) encodeSQL(query string) (string, error) {
+	enc := rc.encoding()
+	if enc == nil {
+		return query, nil
+	}
+	encoded, err := enc.NewEncoder().String(query)
+	if err != nil {
+		return "", fmt.Errorf("rtdb: encode sql to %s failed: %w", rc.config.Charset, err)
+	}
+	return encoded, nil
+}
+
+// decodeString converts s from Config.Charset to UTF-8, bytes which are invalid in
+// the charset are replaced by U+FFFD.
+func (rc *rtdbConn) decodeString(s string) string {
+	enc := rc.encoding()
+	if enc == nil {
+		return s
+	}
+	decoded, err := enc.NewDecoder().String(s)
+	if err != nil {
+		return s
+	}
+	return decoded
+}
+
+// decodeFields converts the column names of fields to UTF-8.
+func (rc *rtdbConn) decodeFields(fields []Field) []Field {
+	if rc.encoding() == nil {
+		return fields
+	}
+	decoded := make([]Field, len(fields))
+	for i, field := range fields {
+		field.Name = rc.decodeString(field.Name)
+		decoded[i] = field
+	}
+	return decoded
+}
+
+// charsetError is an error whose message has been converted from Config.Charset
+// to UTF-8, errors.Is and errors.As see the original error.
+type charsetError struct {
+	msg string
+	err error
+}
+
+func (e *charsetError) Error() string {
+	return e.msg
+}
+
+func (e *charsetError) Unwrap() error {
+	return e.err
+}
+
+// decodeError converts the message of err, which may come from the server, from
+// Config.Charset to UTF-8. The statement of an *Error is replaced by query, the
+// UTF-8 statement it has been encoded from, unless query is empty. err is
+// returned unchanged when its message needs no conversion.
+func (rc *rtdbConn) decodeError(query string, err error) error {
+	if err == nil || rc.encoding() == nil {
+		return err
+	}
+	var rerr *Error
+	if errors.As(err, &rerr) && query != "" && rerr.SQL != "" {
+		rerr.SQL = redactSQL(query)
+	}
+	msg := err.Error()
+	if decoded := rc.decodeString(msg); decoded != msg {
+		return &charsetError{msg: decoded, err: err}
+	}
+	return err
+}
@@ -0,0 +1,109 @@
+package rtdb
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+// go test -timeout 30s -run ^TestCharset$ github.com/racetopdb/gortdb/rtdb -v
+func TestCharset(t *testing.T) {
+	Convey("TestCharset", t, func(ctx C) {
+		gbk := func(s string) string {
+			encoded, err := simplifiedchinese.GBK.NewEncoder().String(s)
+			So(err, ShouldBeNil)
+			return encoded
+		}
+		query := "select 名称 from t where 名称 = '中文'"
+		newBackend := func() *fakeBackend {
+			return &fakeBackend{results: map[string]fakeResult{
+				gbk(query): {
+					fields: []Field{{Name: gbk("名称"), Type: FieldTypeString}, {Name: "data", Type: FieldTypeBinary}},
+					rows:   [][]interface{}{{gbk("中文"), []byte(gbk("中文"))}},
+				},
+				query: {
+					fields: []Field{{Name: "name", Type: FieldTypeString}},
+					rows:   [][]interface{}{{gbk("中文")}},
+				},
+			}}
+		}
+		open := func(backend *fakeBackend, dsn string) *sql.DB {
+			connector, err := NewDriver(WithBackend(func(cfg *Config) (Backend, error) {
+				return backend, nil
+			})).OpenConnector(dsn)
+			So(err, ShouldBeNil)
+			return sql.OpenDB(connector)
+		}
+
+		Convey("SQL should be sent and strings returned in the charset of the DSN", func(ctx C) {
+			backend := newBackend()
+			db := open(backend, "test:test@tcp(127.0.0.1:9000)/?charset=gbk")
+			defer db.Close()
+			rows, err := db.Query("select 名称 from t where 名称 = ?", "中文")
+			So(err, ShouldBeNil)
+			defer rows.Close()
+			So(backend.queries, ShouldContain, gbk(query))
+			columns, err := rows.Columns()
+			So(err, ShouldBeNil)
+			So(columns, ShouldResemble, []string{"名称", "data"})
+			var (
+				name string
+				data []byte
+			)
+			So(rows.Next(), ShouldBeTrue)
+			So(rows.Scan(&name, &data), ShouldBeNil)
+			So(name, ShouldEqual, "中文")
+			// binary columns are never converted
+			So(string(data), ShouldEqual, gbk("中文"))
+		})
+
+		Convey("rawStrings should send and return strings as they are", func(ctx C) {
+			backend := newBackend()
+			db := open(backend, "test:test@tcp(127.0.0.1:9000)/?charset=gbk&rawStrings=true")
+			defer db.Close()
+			var name string
+			So(db.QueryRow(query).Scan(&name), ShouldBeNil)
+			So(name, ShouldEqual, gbk("中文"))
+		})
+
+		Convey("A character missing from the charset should fail the statement", func(ctx C) {
+			backend := newBackend()
+			db := open(backend, "test:test@tcp(127.0.0.1:9000)/?charset=gbk")
+			defer db.Close()
+			_, err := db.Exec("insert into t(name) values('😀')")
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldStartWith, "rtdb: encode sql to gbk failed")
+			So(backend.queries, ShouldNotContain, "insert into t(name) values('😀')")
+		})
+
+		Convey("Errors should be decoded from the charset of the DSN", func(ctx C) {
+			backend := newBackend()
+			serverErr := fmt.Errorf("table %s does not exist", gbk("表"))
+			backend.results[gbk("select * from 表")] = fakeResult{err: serverErr}
+			backend.results[gbk("select * from 表b")] = fakeResult{err: newError(opQuery, EINVAL, gbk("select * from 表b"))}
+			db := open(backend, "test:test@tcp(127.0.0.1:9000)/?charset=gbk")
+			defer db.Close()
+
+			_, err := db.Query("select * from 表")
+			So(err.Error(), ShouldEqual, "table 表 does not exist")
+			So(errors.Is(err, serverErr), ShouldBeTrue)
+
+			_, err = db.Query("select * from 表b")
+			var rerr *Error
+			So(errors.As(err, &rerr), ShouldBeTrue)
+			So(rerr.SQL, ShouldEqual, "select * from 表b")
+			So(errors.Is(err, InvalidArgs), ShouldBeTrue)
+		})
+
+		Convey("rawStrings should be a boolean", func(ctx C) {
+			_, err := ParseDSN("/db?rawStrings=yes")
+			var perr *ParseError
+			So(errors.As(err, &perr), ShouldBeTrue)
+			So(perr.Part, ShouldEqual, "rawStrings")
+		})
+	})
+}
@@ -3,21 +3,34 @@ package rtdb
 
 import (
 	"context"
+	"database/sql"
 	"database/sql/driver"
-	"fmt"
-	"strings"
+	"runtime"
+	"sync"
 	"time"
 )
 
-type rtdbConn struct {
-	RtdbAdapter
+const (
+	// pingQuery is the trivial statement used to check that the server link is alive.
+	pingQuery = "SHOW DATABASES;"
+)
 
-	reset      bool // set for the sql/database/driver SessionResetter interface.
-	config     *Config
-	closed     AtomicBool
-	closech    chan int
-	ctxErr     AtomicError
-	isWatching bool
+type rtdbConn struct {
+	backend Backend
+	hooks   Hooks  // set by WithHooks
+	logger  Logger // set by WithLogger, see logf
+
+	reset     bool    // set for the sql/database/driver SessionResetter interface.
+	tx        *rtdbTx // running write batch, nil outside of a transaction.
+	config    *Config
+	closed    AtomicBool
+	closeOnce sync.Once
+	// quarantined is closed when the native call abandoned by withContext returns,
+	// nil when no call has been abandoned.
+	quarantined chan struct{}
+	closech     chan int
+	ctxErr      AtomicError
+	isWatching  bool
 }
 
 func (rc *rtdbConn) deadline(ctx context.Context, now time.Time) time.Time {
@@ -32,26 +45,33 @@ func (rc *rtdbConn) deadline(ctx context.Context, now time.Time) time.Time {
 		if d.IsZero() || earliest.Before(d) {
 			return earliest
 		}
+		return d
 	}
 	return earliest
 }
 
+// Deprecated: Drivers should implement ConnBeginTx instead.
 func (rc *rtdbConn) Begin() (driver.Tx, error) {
-	panic("Do not support transaction!!!")
+	return rc.BeginTx(context.Background(), driver.TxOptions{})
 }
 
 func (rc *rtdbConn) Close() (err error) {
 	return rc.close()
 }
 
+// Deprecated: Drivers should implement ConnPrepareContext instead.
 func (rc *rtdbConn) Prepare(query string) (driver.Stmt, error) {
-	panic("Prepared SQL Statement is not supported!!!!")
+	return rc.PrepareContext(context.Background(), query)
 }
 
 // Deprecated: Drivers should implement ExecerContext instead.
 func (rc *rtdbConn) Exec(query string, args []driver.Value) (driver.Result, error) {
+	return rc.exec(context.Background(), query, args)
+}
+
+func (rc *rtdbConn) exec(ctx context.Context, query string, args []driver.Value) (driver.Result, error) {
 	if rc.closed.IsSet() {
-		rtdbLogger.Println("err: rtdb is closed")
+		rc.logf("err: rtdb is closed")
 		return nil, driver.ErrBadConn
 	}
 	if len(args) != 0 {
@@ -61,27 +81,34 @@ func (rc *rtdbConn) Exec(query string, args []driver.Value) (driver.Result, erro
 		}
 		query = queryFmt
 	}
+	return rc.execQuery(ctx, query)
+}
 
-	if err := rc.exec(query); err != nil {
+// execQuery executes a query whose placeholders have already been replaced.
+func (rc *rtdbConn) execQuery(ctx context.Context, query string) (driver.Result, error) {
+	if rc.tx != nil && !isReadStatement(query) {
+		rc.tx.buffer(query)
+		return &rtdbResult{buffered: true}, nil
+	}
+	if err := rc.execStatement(ctx, query); err != nil {
 		return nil, err
 	}
-
-	return &rtdbResult{
-		insertId:     int64(rc.insertId),
-		affectedRows: int64(rc.affectedRows),
-	}, nil
+	result := &rtdbResult{
+		affectedRows: int64(rc.backend.AffectedRows()),
+	}
+	if err := rc.freeResult(); err != nil {
+		return nil, err
+	}
+	return result, nil
 }
 
 func (rc *rtdbConn) freeResult() error {
-	if err := rc.freeResult(); err != nil {
-		return err
-	}
-	return nil
+	return rc.backend.FreeResult()
 }
 
-func (rc *rtdbConn) query(query string, args []driver.Value) (*rtdbRows, error) {
+func (rc *rtdbConn) query(ctx context.Context, query string, args []driver.Value) (*rtdbRows, error) {
 	if rc.closed.IsSet() {
-		rtdbLogger.Printf("before query, rtdb connection is closed")
+		rc.logf("before query, rtdb connection is closed")
 		return nil, driver.ErrBadConn
 	}
 	if len(args) != 0 {
@@ -91,33 +118,43 @@ func (rc *rtdbConn) query(query string, args []driver.Value) (*rtdbRows, error)
 		}
 		query = queryFmt
 	}
-	if DEBUG_PRINT_SQL {
-		rtdbLogger.Printf("Query sql: %s\n", query)
+	return rc.queryQuery(ctx, query)
+}
+
+// queryQuery executes a query whose placeholders have already been replaced, in
+// streaming mode when it is enabled by ctx or the DSN.
+func (rc *rtdbConn) queryQuery(ctx context.Context, query string) (*rtdbRows, error) {
+	if opts, ok := rc.streamOptions(ctx); ok {
+		return rc.streamQuery(ctx, query, opts)
 	}
-	// execute query
-	if err := rc.CgoQuery(query, rc.config.Charset, rc.config.DBName); err != nil {
-		return nil, err
+	return rc.fetchQuery(ctx, query)
+}
+
+// fetchQuery executes a query and stores its whole result.
+func (rc *rtdbConn) fetchQuery(ctx context.Context, query string) (*rtdbRows, error) {
+	if DEBUG_PRINT_SQL {
+		rc.logf("Query sql: %s\n", query)
 	}
-	// read result
-	err := rc.ScanResult()
-	if err != nil {
+	// execute query and read result
+	if err := rc.send(ctx, query); err != nil {
 		return nil, err
 	}
-	if rc.IsResultSetEmpty() {
-		return nil, nil
+	if rc.backend.IsResultSetEmpty() {
+		// the statement has no result set, e.g. CREATE or INSERT
+		return &rtdbRows{}, nil
 	}
 
 	rows := &rtdbRows{
 		rc: rc,
 	}
-	rows.resultSet.columns = rc.FetchFields()
+	rows.resultSet.columns = rc.decodeFields(rc.backend.FetchFields())
 
 	return rows, nil
 }
 
 // Deprecated: Drivers should implement QueryerContext instead.
 func (rc *rtdbConn) Query(query string, args []driver.Value) (driver.Rows, error) {
-	return rc.query(query, args)
+	return rc.query(context.Background(), query, args)
 }
 
 func namedValueToValue(named []driver.NamedValue) ([]driver.Value, error) {
@@ -138,9 +175,9 @@ func (rc *rtdbConn) ExecContext(ctx context.Context, query string, args []driver
 	if err != nil {
 		return nil, err
 	}
-	if err = rc.withContext(ctx, func() error {
+	if err = rc.withStatement(ctx, query, func() error {
 		var err error
-		result, err = rc.Exec(query, values)
+		result, err = rc.exec(ctx, query, values)
 		return err
 	}); err != nil {
 		return nil, err
@@ -156,125 +193,199 @@ func (rc *rtdbConn) QueryContext(ctx context.Context, query string, args []drive
 	)
 	values, err := namedValueToValue(args)
 	if err != nil {
-		rtdbLogger.Println(err)
+		rc.logf("%v", err)
 		return nil, err
 	}
-	if err = rc.withContext(ctx, func() error {
+	if err = rc.withStatement(ctx, query, func() error {
 		var err error
-		rows, err = rc.Query(query, values)
+		rows, err = rc.query(ctx, query, values)
 		return err
 	}); err != nil {
-		rtdbLogger.Println(err)
+		rc.logf("%v", err)
 		return nil, err
 	}
 	return rows, nil
 }
 
-// Ping implements driver.Pinger interface.
+// Ping implements driver.Pinger interface. It returns driver.ErrBadConn when the
+// server link is gone, so database/sql drops the connection and dials a new one.
 func (rc *rtdbConn) Ping(ctx context.Context) (err error) {
-	panic("Not implemented")
+	if rc.closed.IsSet() {
+		rc.logf("err: rtdb is closed")
+		return driver.ErrBadConn
+	}
+	return rc.withTimeout(ctx, "read", rc.readTimeout(), func() error {
+		return rc.ping(ctx)
+	})
+}
+
+// ping does a cheap round trip to the server and marks the connection bad on failure.
+func (rc *rtdbConn) ping(ctx context.Context) error {
+	if err := rc.execStatement(ctx, pingQuery); err != nil {
+		rc.logf("ping failed, err: %v", err)
+		rc.markBad()
+		return driver.ErrBadConn
+	}
+	if err := rc.freeResult(); err != nil {
+		rc.logf("free ping result failed, err: %v", err)
+	}
+	if !rc.backend.IsLogined() {
+		rc.logf("ping failed, rtdb is not logined")
+		rc.markBad()
+		return driver.ErrBadConn
+	}
+	return nil
 }
 
-// BeginTx does not support database transaction.
+// markBad marks the connection unusable, the following calls return driver.ErrBadConn.
+func (rc *rtdbConn) markBad() {
+	rc.closed.Set(true)
+}
+
+// BeginTx starts a client side write batch, see rtdbTx. Only the default
+// isolation level is supported.
 func (rc *rtdbConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
-	panic("Do not support database transaction.")
+	if rc.closed.IsSet() {
+		rc.logf("err: rtdb is closed")
+		return nil, driver.ErrBadConn
+	}
+	if opts.Isolation != driver.IsolationLevel(sql.LevelDefault) {
+		return nil, TxIsolationNotSupported
+	}
+	if opts.ReadOnly {
+		return nil, TxReadOnlyNotSupported
+	}
+	if rc.tx != nil {
+		return nil, TxNested
+	}
+	if err := rc.watchContext(ctx); err != nil {
+		return nil, err
+	}
+	rc.tx = &rtdbTx{rc: rc}
+	return rc.tx, nil
 }
 
+// PrepareContext parses the query once, the parsed template is cached and shared by
+// all connections, so preparing the same query again does not parse it again.
 func (rc *rtdbConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
-	panic("Prepared SQL Statement is not supported!!!!")
+	if rc.closed.IsSet() {
+		rc.logf("err: rtdb is closed")
+		return nil, driver.ErrBadConn
+	}
+	if err := rc.watchContext(ctx); err != nil {
+		return nil, err
+	}
+	return &rtdbStmt{
+		rc:  rc,
+		tpl: queryTemplates.get(query),
+	}, nil
 }
 
+// ResetSession is called by database/sql before a pooled connection is reused. It
+// only checks the local state like IsValid, so reusing a connection costs no round
+// trip and never waits for the login; use Ping to check the server link.
 func (rc *rtdbConn) ResetSession(ctx context.Context) error {
-	if rc.closed.IsSet() {
-		rtdbLogger.Printf("err: rtdb is closed")
+	if !rc.IsValid() {
 		return driver.ErrBadConn
 	}
 	rc.reset = true
 	return nil
 }
 
+// IsValid is called by database/sql when a connection is returned to the pool. It
+// checks the state of the connection and of its backend, see Validator, without
+// calling the server. The login is not checked, since the one of libtsdb is
+// shared by the process and checking it may wait for other connections.
 func (rc *rtdbConn) IsValid() bool {
-	return rc.closed.IsSet()
+	if rc.closed.IsSet() {
+		return false
+	}
+	if rc.backend == nil {
+		rc.markBad()
+		return false
+	}
+	if v, ok := rc.backend.(Validator); ok && !v.Valid() {
+		rc.markBad()
+		return false
+	}
+	return true
 }
 
 func (rc *rtdbConn) formatArgs(query string, args []driver.Value) (string, error) {
-	if strings.Count(query, "?") != len(args) {
-		return "", driver.ErrSkip
-	}
-	var queryFmt string
-	var argstrs []string
-	for i := 0; i < len(args); i++ {
-		arg := args[i]
-		switch v := arg.(type) {
-		case int, uint8, int8, uint16, int16, uint32, int32, int64, uint64:
-			argstrs = append(argstrs, fmt.Sprintf("%v", v))
-		case float32, float64:
-			// TODO: 可能需要优化
-			argstrs = append(argstrs, fmt.Sprintf("%v", v))
-		case bool:
-			if v {
-				argstrs = append(argstrs, "true")
-			} else {
-				argstrs = append(argstrs, "false")
-			}
-		case string:
-			argstrs = append(argstrs, fmt.Sprintf("'%s'", v))
-		case time.Time:
-			if v.IsZero() {
-				// TODO: handle zero time
-			} else {
-				timeStr := v.Format("2006-01-02 15:04:05.000")
-				argstrs = append(argstrs, fmt.Sprintf("'%s'", timeStr))
-			}
-		case []byte:
-			if v == nil {
-				argstrs = append(argstrs, "NULL")
-			} else {
-				// TODO:
-			}
-		default:
-			if v == nil {
-				argstrs = append(argstrs, "NULL")
-			} else {
-				return "", driver.ErrSkip
-			}
-		}
-	}
-	old := query
-	for i, arg := range argstrs {
-		if i == 0 {
-			old = query
-		} else {
-			old = queryFmt
-		}
-		queryFmt = strings.Replace(old, "?", arg, 1)
+	return queryTemplates.get(query).format(args, rc.location())
+}
+
+// location returns the time zone of the server, see Config.Location.
+func (rc *rtdbConn) location() *time.Location {
+	if rc.config == nil || rc.config.Location == nil {
+		return time.UTC
 	}
-	return queryFmt, nil
+	return rc.config.Location
 }
 
-func (rc *rtdbConn) close() error {
-	rc.closed.Set(true)
-	close(rc.closech)
-	if err := rc.CgoDisconnect(); err != nil {
-		rtdbLogger.Printf("call c interface tsdb_disconnect failed, err: %v", err)
-		return err
+// parseTime reports whether datetime values are returned as time.Time.
+func (rc *rtdbConn) parseTime() bool {
+	return rc.config == nil || rc.config.ParseTime
+}
+
+// convertTime converts a datetime read from the server according to Config.ParseTime
+// and Config.Location, either a time.Time in Location or epoch milliseconds.
+func (rc *rtdbConn) convertTime(t time.Time) driver.Value {
+	if !rc.parseTime() {
+		return t.UnixNano() / int64(time.Millisecond)
 	}
-	// finally clean up
-	return nil
+	return t.In(rc.location())
 }
 
-func (rc *rtdbConn) exec(query string) error {
-	if DEBUG_PRINT_SQL {
-		rtdbLogger.Printf("Exec sql: %s\n", query)
+func (rc *rtdbConn) close() (err error) {
+	rc.closeOnce.Do(func() {
+		rc.closed.Set(true)
+		if rc.closech != nil {
+			close(rc.closech)
+		}
+		if q := rc.quarantined; q != nil {
+			// the native call is still running on the client, release it afterwards
+			go func() {
+				<-q
+				rc.release()
+			}()
+			return
+		}
+		err = rc.release()
+	})
+	return err
+}
+
+// release disconnects and frees the backend of the connection.
+func (rc *rtdbConn) release() (err error) {
+	defer runtime.SetFinalizer(rc, nil)
+	if rc.backend == nil {
+		return nil
 	}
-	if err := rc.CgoQuery(query, rc.config.Charset, rc.config.DBName); err != nil {
-		return err
+	if err = rc.backend.Disconnect(); err != nil {
+		rc.logf("call c interface tsdb_disconnect failed, err: %v", err)
 	}
+	// finally clean up
+	if cleanErr := rc.backend.CleanUp(); cleanErr != nil {
+		rc.logf("clean up rtdb client failed, err: %v", cleanErr)
+		if err == nil {
+			err = cleanErr
+		}
+	}
+	return err
+}
 
-	if err := rc.CgoStoreResult(); err != nil {
-		return err
+// finalize is the safety net for connections which are never closed.
+func (rc *rtdbConn) finalize() {
+	rc.logf("rtdb connection is garbage collected without close, closing it")
+	rc.close()
+}
+
+func (rc *rtdbConn) execStatement(ctx context.Context, query string) error {
+	if DEBUG_PRINT_SQL {
+		rc.logf("Exec sql: %s\n", query)
 	}
-	return nil
+	return rc.send(ctx, query)
 }
 
 func (rc *rtdbConn) error() error {
@@ -305,23 +416,84 @@ func (rc *rtdbConn) watchContext(ctx context.Context) error {
 	return nil
 }
 
+// withContext runs the native call f under a supervisor. When ctx is done before f
+// returns, ctx.Err() is returned at once and the connection is quarantined: it is
+// marked bad so the pool does not reuse it, and its native client is released once
+// the abandoned call returns, libtsdb has no way to abort a running call.
 func (rc *rtdbConn) withContext(ctx context.Context, f func() error) error {
 	if err := rc.watchContext(ctx); err != nil {
 		return err
 	}
-	if err := f(); err != nil {
-		return err
+	if ctx.Done() == nil {
+		return f()
 	}
+	done := make(chan error, 1)
+	go func() {
+		done <- f()
+	}()
 	select {
+	case err := <-done:
+		return err
 	case <-ctx.Done():
 		rc.ctxErr.Set(ctx.Err())
+		rc.quarantine(done)
 		return ctx.Err()
 	case <-rc.closech:
-	default:
-		// it will always return
-		if ctx.Done() == nil {
-			return nil
-		}
+		rc.quarantine(done)
+		return driver.ErrBadConn
 	}
-	return nil
+}
+
+// withStatement runs the native call f of query under withContext, bounded by
+// Config.ReadTimeout for a read statement and by Config.WriteTimeout otherwise.
+// libtsdb sends a statement and receives its result in one call, so the timeout
+// depends on the statement rather than on the direction of the I/O. A statement
+// which times out is not cancelled, see TimeoutError.
+func (rc *rtdbConn) withStatement(ctx context.Context, query string, f func() error) error {
+	if isReadStatement(query) {
+		return rc.withTimeout(ctx, "read", rc.readTimeout(), f)
+	}
+	return rc.withTimeout(ctx, "write", rc.writeTimeout(), f)
+}
+
+// withTimeout runs f under withContext, bounded by timeout as well as by ctx. When
+// timeout expires first, a *TimeoutError for op is returned.
+func (rc *rtdbConn) withTimeout(ctx context.Context, op string, timeout time.Duration, f func() error) error {
+	if timeout <= 0 {
+		return rc.withContext(ctx, f)
+	}
+	timeoutCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	err := rc.withContext(timeoutCtx, f)
+	if err == context.DeadlineExceeded && ctx.Err() == nil {
+		return &TimeoutError{Op: op, Limit: timeout}
+	}
+	return err
+}
+
+func (rc *rtdbConn) readTimeout() time.Duration {
+	if rc.config == nil {
+		return 0
+	}
+	return rc.config.ReadTimeout
+}
+
+func (rc *rtdbConn) writeTimeout() time.Duration {
+	if rc.config == nil {
+		return 0
+	}
+	return rc.config.WriteTimeout
+}
+
+// quarantine marks the connection bad while the native call is still running.
+func (rc *rtdbConn) quarantine(done <-chan error) {
+	rc.markBad()
+	q := make(chan struct{})
+	rc.quarantined = q
+	go func() {
+		if err := <-done; err != nil {
+			rc.logf("abandoned native call returned, err: %v", err)
+		}
+		close(q)
+	}()
 }
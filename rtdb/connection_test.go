@@ -1,8 +1,11 @@
 package rtdb
 
 import (
+	"context"
 	"database/sql/driver"
+	"errors"
 	"testing"
+	"time"
 
 	. "github.com/smartystreets/goconvey/convey"
 )
@@ -30,3 +33,209 @@ func Test_formatArgs(t *testing.T) {
 		})
 	})
 }
+
+// loginUnchecked is a Backend without Validator whose login must not be checked.
+type loginUnchecked struct {
+	Backend
+}
+
+func (loginUnchecked) IsLogined() bool {
+	panic("the login was checked")
+}
+
+// go test -timeout 30s -run ^Test_rtdbConn_Ping$ github.com/racetopdb/gortdb/rtdb -v
+func Test_rtdbConn_Ping(t *testing.T) {
+	Convey("Test_rtdbConn_Ping", t, func(ctx C) {
+		conn := &rtdbConn{closech: make(chan int)}
+		Convey("A closed connection should be reported as bad", func(ctx C) {
+			So(conn.Close(), ShouldBeNil)
+			// close twice should not panic
+			So(conn.Close(), ShouldBeNil)
+			So(conn.Ping(context.Background()), ShouldEqual, driver.ErrBadConn)
+			So(conn.ResetSession(context.Background()), ShouldEqual, driver.ErrBadConn)
+			So(conn.IsValid(), ShouldBeFalse)
+		})
+
+		Convey("Resetting a pooled connection should not do a round trip", func(ctx C) {
+			backend := &fakeBackend{results: map[string]fakeResult{pingQuery: {}}, logined: true}
+			conn := &rtdbConn{backend: backend, config: NewConfig(), closech: make(chan int)}
+			So(conn.ResetSession(context.Background()), ShouldBeNil)
+			So(backend.queries, ShouldBeEmpty)
+			So(conn.Ping(context.Background()), ShouldBeNil)
+			So(backend.queries, ShouldResemble, []string{pingQuery})
+
+			backend.logined = false
+			So(conn.ResetSession(context.Background()), ShouldEqual, driver.ErrBadConn)
+			So(backend.queries, ShouldHaveLength, 1)
+		})
+
+		Convey("Resetting a pooled connection should not check the shared login", func(ctx C) {
+			conn := &rtdbConn{backend: loginUnchecked{&fakeBackend{}}, config: NewConfig(), closech: make(chan int)}
+			So(conn.ResetSession(context.Background()), ShouldBeNil)
+			So(conn.IsValid(), ShouldBeTrue)
+			conn.markBad()
+			So(conn.ResetSession(context.Background()), ShouldEqual, driver.ErrBadConn)
+		})
+	})
+}
+
+// go test -timeout 30s -run ^Test_rtdbConn_convertTime$ github.com/racetopdb/gortdb/rtdb -v
+func Test_rtdbConn_convertTime(t *testing.T) {
+	Convey("Test_rtdbConn_convertTime", t, func(ctx C) {
+		v := time.Date(2021, 1, 1, 0, 0, 0, 123000000, time.UTC)
+		Convey("Datetime should keep milliseconds and be returned in Config.Location", func(ctx C) {
+			config, err := ParseDSN("/dbname?loc=Asia%2FShanghai")
+			So(err, ShouldBeNil)
+			conn := &rtdbConn{config: config}
+			value, ok := conn.convertTime(v).(time.Time)
+			So(ok, ShouldBeTrue)
+			So(value.Equal(v), ShouldBeTrue)
+			So(value.Location().String(), ShouldEqual, "Asia/Shanghai")
+			So(value.Nanosecond(), ShouldEqual, 123000000)
+		})
+
+		Convey("Datetime should be returned as epoch milliseconds when parseTime is false", func(ctx C) {
+			config, err := ParseDSN("/dbname?parseTime=false")
+			So(err, ShouldBeNil)
+			conn := &rtdbConn{config: config}
+			So(conn.convertTime(v), ShouldEqual, int64(1609459200123))
+		})
+	})
+}
+
+// go test -timeout 30s -run ^Test_rtdbConn_withContext$ github.com/racetopdb/gortdb/rtdb -v
+func Test_rtdbConn_withContext(t *testing.T) {
+	Convey("Test_rtdbConn_withContext", t, func(ctx C) {
+		conn := &rtdbConn{closech: make(chan int)}
+		Convey("A hanging call should return as soon as the context is done", func(ctx C) {
+			unblock := make(chan struct{})
+			defer func() {
+				close(unblock)
+				<-conn.quarantined
+			}()
+			baseCtx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			defer cancel()
+			start := time.Now()
+			err := conn.withContext(baseCtx, func() error {
+				<-unblock
+				return nil
+			})
+			So(err, ShouldBeError, context.DeadlineExceeded)
+			So(time.Since(start), ShouldBeLessThan, time.Second)
+
+			// the connection is quarantined until the abandoned call returns
+			So(conn.IsValid(), ShouldBeFalse)
+			So(conn.Ping(context.Background()), ShouldEqual, driver.ErrBadConn)
+			So(conn.Close(), ShouldBeNil)
+		})
+
+		Convey("A finished call should return its own result", func(ctx C) {
+			baseCtx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			err := conn.withContext(baseCtx, func() error {
+				return InvalidArgs
+			})
+			So(err, ShouldEqual, InvalidArgs)
+			So(conn.closed.IsSet(), ShouldBeFalse)
+		})
+	})
+}
+
+// blockingBackend is a backend whose native calls hang until unblock is closed.
+type blockingBackend struct {
+	fakeBackend
+	unblock  chan struct{}
+	returned chan struct{} // receives a value when a native call returns
+}
+
+func newBlockingBackend(results map[string]fakeResult) *blockingBackend {
+	return &blockingBackend{
+		fakeBackend: fakeBackend{results: results, logined: true},
+		unblock:     make(chan struct{}),
+		returned:    make(chan struct{}, 1),
+	}
+}
+
+func (b *blockingBackend) Connect() error {
+	defer func() { b.returned <- struct{}{} }()
+	<-b.unblock
+	return b.fakeBackend.Connect()
+}
+
+func (b *blockingBackend) Query(sql string, charset string, db string) error {
+	defer func() { b.returned <- struct{}{} }()
+	<-b.unblock
+	return b.fakeBackend.Query(sql, charset, db)
+}
+
+// release unblocks the native call and waits until it has returned.
+func (b *blockingBackend) release() {
+	close(b.unblock)
+	<-b.returned
+}
+
+// go test -timeout 30s -run ^Test_rtdbConn_withTimeout$ github.com/racetopdb/gortdb/rtdb -v
+func Test_rtdbConn_withTimeout(t *testing.T) {
+	Convey("Test_rtdbConn_withTimeout", t, func(ctx C) {
+		backend := newBlockingBackend(map[string]fakeResult{"select * from t": {}, "insert into t(id) values(1)": {}})
+		config, err := ParseDSN("/dbname?readTimeout=10ms&writeTimeout=20ms")
+		So(err, ShouldBeNil)
+		conn := &rtdbConn{backend: backend, config: config, closech: make(chan int)}
+		defer func() {
+			backend.release()
+			if q := conn.quarantined; q != nil {
+				<-q
+			}
+		}()
+
+		Convey("A read statement should be abandoned after the read timeout", func(ctx C) {
+			_, err := conn.QueryContext(context.Background(), "select * from t", nil)
+			So(errors.Is(err, context.DeadlineExceeded), ShouldBeTrue)
+			var terr *TimeoutError
+			So(errors.As(err, &terr), ShouldBeTrue)
+			So(terr.Op, ShouldEqual, "read")
+			So(terr.Limit, ShouldEqual, 10*time.Millisecond)
+			So(conn.IsValid(), ShouldBeFalse)
+		})
+
+		Convey("A write statement should be abandoned after the write timeout", func(ctx C) {
+			_, err := conn.ExecContext(context.Background(), "insert into t(id) values(1)", nil)
+			So(err, ShouldBeError, "rtdb: write timeout after 20ms")
+			So(errors.Is(err, context.DeadlineExceeded), ShouldBeTrue)
+		})
+
+		Convey("The deadline of the context should be reported as it is", func(ctx C) {
+			baseCtx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+			defer cancel()
+			_, err := conn.QueryContext(baseCtx, "select * from t", nil)
+			So(err == context.DeadlineExceeded, ShouldBeTrue)
+		})
+
+		Convey("The dial timeout should abandon the connect", func(ctx C) {
+			connector, err := NewDriver(WithBackend(func(cfg *Config) (Backend, error) {
+				return backend, nil
+			})).OpenConnector("test:test@tcp(127.0.0.1:9000)/?timeout=10ms")
+			So(err, ShouldBeNil)
+			_, err = connector.Connect(context.Background())
+			So(err, ShouldBeError, "rtdb: dial timeout after 10ms")
+			So(errors.Is(err, context.DeadlineExceeded), ShouldBeTrue)
+		})
+	})
+}
+
+// go test -timeout 30s -run ^Test_rtdbConn_deadline$ github.com/racetopdb/gortdb/rtdb -v
+func Test_rtdbConn_deadline(t *testing.T) {
+	Convey("Test_rtdbConn_deadline", t, func(ctx C) {
+		now := time.Now()
+		conn := &rtdbConn{config: &Config{DialTimeout: time.Second}}
+		So(conn.deadline(context.Background(), now).Equal(now.Add(time.Second)), ShouldBeTrue)
+
+		baseCtx, cancel := context.WithDeadline(context.Background(), now.Add(time.Millisecond))
+		defer cancel()
+		So(conn.deadline(baseCtx, now).Equal(now.Add(time.Millisecond)), ShouldBeTrue)
+
+		baseCtx, cancel = context.WithDeadline(context.Background(), now.Add(time.Minute))
+		defer cancel()
+		So(conn.deadline(baseCtx, now).Equal(now.Add(time.Second)), ShouldBeTrue)
+	})
+}
@@ -3,33 +3,146 @@ package rtdb
 import (
 	"context"
 	"database/sql/driver"
+	"runtime"
+	"sync"
+	"time"
 )
 
 type connector struct {
-	config *Config
+	config      *Config
+	newBackend  BackendFactory     // set by WithBackend, the registered backend is used when nil
+	hooks       Hooks              // set by WithHooks
+	logger      Logger             // set by WithLogger, the driver logger is used when nil
+	credentials CredentialProvider // set by WithCredentials, the user and password of the DSN are used when nil
+	opts        []Option           // options applied to the connector, for Driver
+
+	hostsOnce sync.Once
+	hosts     *hostPool // hosts of Config.Address, shared by the connections
+}
+
+func newConnector(config *Config, opts ...Option) *connector {
+	c := &connector{
+		config: config,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.opts = opts
+	return c
 }
 
-// TODO: how to use context for call c function (CgoConnect).
+// Connect opens a new connection to one of the hosts of the DSN, in the order of
+// Config.HostPolicy. A host which fails to connect is marked down for
+// Config.HostCooldown and the next host is tried. The credential provider of
+// WithCredentials is consulted once per connection.
 func (c *connector) Connect(cxt context.Context) (driver.Conn, error) {
-	var (
-		err error
-	)
-	host, port := c.config.HostAndPort()
+	newBackend := c.newBackend
+	if newBackend == nil {
+		factory, err := lookupBackend(c.config.Backend)
+		if err != nil {
+			return nil, err
+		}
+		newBackend = factory
+	}
+	c.hostsOnce.Do(func() {
+		c.hosts = newHostPool(c.config)
+	})
+	base := *c.config
+	if err := c.applyCredentials(cxt, &base); err != nil {
+		return nil, err
+	}
+	hosts := c.hosts.order()
+	var err error
+	for _, host := range hosts {
+		config := base
+		config.Address = host
+		config.TLS = tlsForHost(config.TLS, host)
+		var backend Backend
+		if backend, err = newBackend(&config); err != nil {
+			// the backend of the host can not be created, it is not known to be down
+			if len(hosts) > 1 {
+				c.logf("create the backend of %s failed, err: %v", host, err)
+			}
+			continue
+		}
+		var rc *rtdbConn
+		if rc, err = c.connect(cxt, backend, &config); err == nil {
+			return rc, nil
+		}
+		if cxt.Err() != nil {
+			// the caller gave up, the host is not known to be down
+			break
+		}
+		c.hosts.markDown(host)
+		if len(hosts) > 1 {
+			c.logf("connect to %s failed, err: %v", host, err)
+		}
+	}
+	return nil, err
+}
+
+// connect logs backend in to the host of config. The native connect runs under
+// the supervisor of withContext, it is abandoned at the earliest of
+// Config.DialTimeout and the deadline of the context.
+func (c *connector) connect(cxt context.Context, backend Backend, config *Config) (*rtdbConn, error) {
 	rc := &rtdbConn{
-		RtdbAdapter: *NewRtdbAdapter(host, port, c.config.User, c.config.Password),
-		config:      c.config,
-		closech:     make(chan int),
+		backend: backend,
+		hooks:   c.hooks,
+		logger:  c.logger,
+		config:  config,
+		closech: make(chan int),
 	}
+	runtime.SetFinalizer(rc, (*rtdbConn).finalize)
 
-	if err = rc.withContext(cxt, func() error {
-		return rc.CgoConnect()
+	dialCtx := cxt
+	// a deadline of its own only for Config.DialTimeout, the one of cxt decides
+	// whether the caller gave up
+	if deadline := rc.deadline(cxt, time.Now()); !deadline.IsZero() && !hasDeadline(cxt, deadline) {
+		var cancel context.CancelFunc
+		dialCtx, cancel = context.WithDeadline(cxt, deadline)
+		defer cancel()
+	}
+	if err := rc.withContext(dialCtx, func() error {
+		return rc.backend.Connect()
 	}); err != nil {
+		rc.close()
+		if err == context.DeadlineExceeded && cxt.Err() == nil {
+			err = &TimeoutError{Op: "dial", Limit: config.DialTimeout}
+		}
 		return nil, err
 	}
-
 	return rc, nil
 }
 
+// hasDeadline reports whether ctx expires not later than deadline.
+func hasDeadline(ctx context.Context, deadline time.Time) bool {
+	d, ok := ctx.Deadline()
+	return ok && !d.After(deadline)
+}
+
+// NewConnector returns a connector for cfg to be used with sql.OpenDB, it is the
+// programmatic equivalent of opening the DSN cfg.FormatDSN(). cfg is copied, later
+// changes do not affect the connector.
+func NewConnector(cfg *Config, opts ...Option) (driver.Connector, error) {
+	if cfg == nil {
+		return nil, &ParseError{Part: "config", Reason: "nil Config"}
+	}
+	config := *cfg
+	if cfg.Params != nil {
+		config.Params = make(map[string]string, len(cfg.Params))
+		for k, v := range cfg.Params {
+			config.Params[k] = v
+		}
+	}
+	if config.Location == nil {
+		config.Location = time.UTC
+	}
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	return newConnector(&config, opts...), nil
+}
+
 func (c *connector) Driver() driver.Driver {
-	return &RtdbDriver{}
+	return &RtdbDriver{opts: c.opts}
 }
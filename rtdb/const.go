@@ -5,5 +5,5 @@ const (
 )
 
 var (
-	DEBUG_PRINT_SQL = true
+	DEBUG_PRINT_SQL = false
 )
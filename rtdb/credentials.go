@@ -0,0 +1,105 @@
+package rtdb
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// Credentials are the user and password a connection logs in with.
+type Credentials struct {
+	User     string
+	Password string
+}
+
+// String returns the user, the password is redacted.
+func (c Credentials) String() string {
+	if c.Password == "" {
+		return c.User
+	}
+	return c.User + ":" + redactedSecret
+}
+
+// GoString is String, so that %#v does not print the password either.
+func (c Credentials) GoString() string {
+	return c.String()
+}
+
+// CredentialProvider supplies the credentials of the connections. It is consulted
+// on every new connection, so that rotated credentials are used without reopening
+// the sql.DB. An empty User keeps the user of the DSN.
+type CredentialProvider interface {
+	Credentials(ctx context.Context) (Credentials, error)
+}
+
+// CredentialFunc is a CredentialProvider calling the function.
+type CredentialFunc func(ctx context.Context) (Credentials, error)
+
+func (f CredentialFunc) Credentials(ctx context.Context) (Credentials, error) {
+	return f(ctx)
+}
+
+// StaticCredentials returns a CredentialProvider of fixed credentials.
+func StaticCredentials(user, password string) CredentialProvider {
+	return CredentialFunc(func(ctx context.Context) (Credentials, error) {
+		return Credentials{User: user, Password: password}, nil
+	})
+}
+
+// EnvCredentials returns a CredentialProvider reading the password from the
+// environment variable passwordVar and the user from userVar, the user of the
+// DSN is kept when userVar is empty.
+func EnvCredentials(userVar, passwordVar string) CredentialProvider {
+	return CredentialFunc(func(ctx context.Context) (Credentials, error) {
+		var creds Credentials
+		if userVar != "" {
+			creds.User = os.Getenv(userVar)
+		}
+		password, ok := os.LookupEnv(passwordVar)
+		if !ok {
+			return Credentials{}, fmt.Errorf("environment variable %s is not set", passwordVar)
+		}
+		creds.Password = password
+		return creds, nil
+	})
+}
+
+// FileCredentials returns a CredentialProvider reading the password from the file
+// at path, e.g. a mounted secret. The file is read on every new connection, the
+// trailing line break is ignored. The user of the DSN is kept when user is empty.
+func FileCredentials(user, path string) CredentialProvider {
+	return CredentialFunc(func(ctx context.Context) (Credentials, error) {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return Credentials{}, err
+		}
+		return Credentials{User: user, Password: strings.TrimRight(string(data), "\r\n")}, nil
+	})
+}
+
+// WithCredentials makes the connections log in with the credentials of provider
+// instead of the user and password of the DSN.
+func WithCredentials(provider CredentialProvider) Option {
+	return func(c *connector) {
+		c.credentials = provider
+	}
+}
+
+// applyCredentials sets the user and password of config from the credential
+// provider of the connector.
+func (c *connector) applyCredentials(ctx context.Context, config *Config) error {
+	if c.credentials == nil {
+		return nil
+	}
+	creds, err := c.credentials.Credentials(ctx)
+	if err != nil {
+		return fmt.Errorf("rtdb: get credentials failed: %w", err)
+	}
+	if creds.User != "" {
+		config.User = creds.User
+	}
+	config.Password = creds.Password
+	return nil
+}
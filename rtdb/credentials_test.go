@@ -0,0 +1,131 @@
+package rtdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// go test -timeout 30s -run ^TestCredentialProvider$ github.com/racetopdb/gortdb/rtdb -v
+func TestCredentialProvider(t *testing.T) {
+	Convey("TestCredentialProvider", t, func(ctx C) {
+		Convey("Static credentials should be returned as they are", func(ctx C) {
+			creds, err := StaticCredentials("u", "s3cret").Credentials(context.Background())
+			So(err, ShouldBeNil)
+			So(creds, ShouldResemble, Credentials{User: "u", Password: "s3cret"})
+			So(fmt.Sprintf("%v %+v %#v", creds, creds, creds), ShouldNotContainSubstring, "s3cret")
+			So(creds.String(), ShouldEqual, "u:xxxxx")
+		})
+
+		Convey("Env credentials should read the environment on every call", func(ctx C) {
+			So(os.Setenv("GORTDB_TEST_PASSWORD", "first"), ShouldBeNil)
+			defer os.Unsetenv("GORTDB_TEST_PASSWORD")
+			provider := EnvCredentials("", "GORTDB_TEST_PASSWORD")
+			creds, err := provider.Credentials(context.Background())
+			So(err, ShouldBeNil)
+			So(creds, ShouldResemble, Credentials{Password: "first"})
+			So(os.Setenv("GORTDB_TEST_PASSWORD", "second"), ShouldBeNil)
+			creds, err = provider.Credentials(context.Background())
+			So(err, ShouldBeNil)
+			So(creds.Password, ShouldEqual, "second")
+
+			_, err = EnvCredentials("", "GORTDB_TEST_MISSING").Credentials(context.Background())
+			So(err, ShouldBeError, "environment variable GORTDB_TEST_MISSING is not set")
+		})
+
+		Convey("File credentials should read the file on every call", func(ctx C) {
+			dir, err := ioutil.TempDir("", "gortdb")
+			So(err, ShouldBeNil)
+			defer os.RemoveAll(dir)
+			path := filepath.Join(dir, "password")
+			So(ioutil.WriteFile(path, []byte("first\n"), 0600), ShouldBeNil)
+			provider := FileCredentials("u", path)
+			creds, err := provider.Credentials(context.Background())
+			So(err, ShouldBeNil)
+			So(creds, ShouldResemble, Credentials{User: "u", Password: "first"})
+			So(ioutil.WriteFile(path, []byte("second"), 0600), ShouldBeNil)
+			creds, err = provider.Credentials(context.Background())
+			So(err, ShouldBeNil)
+			So(creds.Password, ShouldEqual, "second")
+		})
+	})
+}
+
+// go test -timeout 30s -run ^TestWithCredentials$ github.com/racetopdb/gortdb/rtdb -v
+func TestWithCredentials(t *testing.T) {
+	Convey("TestWithCredentials", t, func(ctx C) {
+		var seen []Credentials
+		password := "first"
+		fail := errors.New("vault is sealed")
+		var providerErr error
+		provider := CredentialFunc(func(ctx context.Context) (Credentials, error) {
+			return Credentials{Password: password}, providerErr
+		})
+		connector, err := NewDriver(
+			WithBackend(func(cfg *Config) (Backend, error) {
+				seen = append(seen, Credentials{User: cfg.User, Password: cfg.Password})
+				return &fakeBackend{results: map[string]fakeResult{pingQuery: {}}}, nil
+			}),
+			WithCredentials(provider),
+		).OpenConnector("test:dsn@tcp(127.0.0.1:9000)/")
+		So(err, ShouldBeNil)
+
+		Convey("Every new connection should use the current credentials", func(ctx C) {
+			conn, err := connector.Connect(context.Background())
+			So(err, ShouldBeNil)
+			So(conn.Close(), ShouldBeNil)
+			password = "second"
+			conn, err = connector.Connect(context.Background())
+			So(err, ShouldBeNil)
+			So(conn.Close(), ShouldBeNil)
+			So(seen, ShouldResemble, []Credentials{{User: "test", Password: "first"}, {User: "test", Password: "second"}})
+		})
+
+		Convey("A failing provider should fail the connection", func(ctx C) {
+			providerErr = fail
+			_, err := connector.Connect(context.Background())
+			So(errors.Is(err, fail), ShouldBeTrue)
+			So(seen, ShouldBeEmpty)
+		})
+	})
+}
+
+// go test -timeout 30s -run ^TestRedactSecrets$ github.com/racetopdb/gortdb/rtdb -v
+func TestRedactSecrets(t *testing.T) {
+	Convey("TestRedactSecrets", t, func(ctx C) {
+		Convey("Passwords of connection strings and statements should be redacted", func(ctx C) {
+			So(redactSecrets("user=u;passwd=s3cret;servers=tcp://h:9000"), ShouldEqual, "user=u;passwd=xxxxx;servers=tcp://h:9000")
+			So(redactSecrets("/db?password=s3cret&loc=UTC"), ShouldEqual, "/db?password=xxxxx&loc=UTC")
+			So(redactSecrets("create user u identified by 's3''cret'"), ShouldEqual, "create user u identified by 'xxxxx'")
+			So(redactSecrets(`ALTER USER u PASSWORD "s3cret"`), ShouldEqual, `ALTER USER u PASSWORD 'xxxxx'`)
+			So(redactSecrets("select * from t where name = 'password'"), ShouldEqual, "select * from t where name = 'password'")
+		})
+
+		Convey("A printed Config should not contain the password", func(ctx C) {
+			config, err := ParseDSN("test:s3cret@tcp(127.0.0.1:9000)/dbname")
+			So(err, ShouldBeNil)
+			for _, s := range []string{fmt.Sprint(config), fmt.Sprintf("%+v", config), fmt.Sprintf("%#v", config)} {
+				So(s, ShouldNotContainSubstring, "s3cret")
+				So(s, ShouldStartWith, "test:xxxxx@")
+			}
+			So(config.FormatDSN(), ShouldContainSubstring, "s3cret")
+		})
+
+		Convey("Log lines should not contain passwords", func(ctx C) {
+			logger := &bufferLogger{}
+			// the lines logged with DEBUG_PRINT_SQL and by a failed connect
+			(&rtdbConn{logger: logger}).logf("Exec sql: %s\n", "create user u identified by 's3cret'")
+			(&connector{logger: logger}).logf("connect to %s failed", "user=u;passwd=s3cret;servers=tcp://h:9000")
+			So(logger.messages, ShouldHaveLength, 2)
+			for _, msg := range logger.messages {
+				So(msg, ShouldNotContainSubstring, "s3cret")
+			}
+		})
+	})
+}
@@ -7,16 +7,22 @@ import (
 	"database/sql/driver"
 )
 
-type RtdbDriver struct{}
+type RtdbDriver struct {
+	opts []Option
+}
+
+// NewDriver returns a driver whose connectors are configured by opts, it can be
+// registered with sql.Register under another name.
+func NewDriver(opts ...Option) *RtdbDriver {
+	return &RtdbDriver{opts: opts}
+}
 
 func (rd RtdbDriver) Open(dsn string) (driver.Conn, error) {
 	config, err := ParseDSN(dsn)
 	if err != nil {
 		return nil, err
 	}
-	c := &connector{
-		config: config,
-	}
+	c := newConnector(config, rd.opts...)
 	return c.Connect(context.Background())
 }
 
@@ -29,8 +35,6 @@ func (rd RtdbDriver) OpenConnector(dsn string) (driver.Connector, error) {
 	if err != nil {
 		return nil, err
 	}
-	c := &connector{
-		config: config,
-	}
+	c := newConnector(config, rd.opts...)
 	return c, nil
 }
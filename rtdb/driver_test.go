@@ -1,9 +1,13 @@
+//go:build cgo
+// +build cgo
+
 package rtdb
 
 import (
 	"database/sql"
 	"fmt"
 	"log"
+	"net/url"
 	"os"
 	"testing"
 	"time"
@@ -57,7 +61,8 @@ func init() {
 	port = getEnv("RTDB_TEST_PORT", "9000")
 	address = getEnv("RTDB_TEST_ADDRESS", "127.0.0.1:9000")
 	dbname = getEnv("RTDB_TEST_DBNAME", "test_db")
-	dsn = fmt.Sprintf("%s:%s@tcp(%s)/%s?param1=value1&param2=value2", user, password, address, dbname)
+	libPath := getEnv("RTDB_LIB_PATH", "../dll/linux")
+	dsn = fmt.Sprintf("%s:%s@tcp(%s)/%s?param1=value1&param2=value2&libPath=%s", user, password, address, dbname, url.QueryEscape(libPath))
 	_, err := rd.Open(dsn)
 	if err != nil {
 		panic(err)
@@ -1,7 +1,11 @@
 package rtdb
 
 import (
+	"crypto/tls"
+	"errors"
+	"fmt"
 	"net/url"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -19,15 +23,29 @@ type Config struct {
 	User         string            // Username
 	Password     string            // Password
 	Protocol     string            // Net protocol type
-	Address      string            // Network address
+	Address      string            // Network address, several hosts are separated by commas
 	DBName       string            // Database name
 	Location     *time.Location    // Time zone setting
-	DialTimeout  time.Duration     // Dial timeout
-	ReadTimeout  time.Duration     // I/O read timeout
-	WriteTimeout time.Duration     // I/O write timeout
-	Charset      string            // Character set
+	DialTimeout  time.Duration     // Dial timeout, 0 disables it
+	ReadTimeout  time.Duration     // Timeout of a statement which reads data, 0 disables it
+	WriteTimeout time.Duration     // Timeout of a statement which writes data, 0 disables it
+	Charset      string            // Character set, SQL and STRING columns are converted from and to it
+	RawStrings   bool              // Send SQL and return STRING columns without converting them to Charset
 	Params       map[string]string // Connection parameters
 	ParseTime    bool              // Parse time values to time.Time
+	StreamWindow time.Duration     // Read queries in chunks of this time range, 0 disables streaming
+	LibPath      string            // Path of libtsdb.so or of its directory, searched when empty
+	Backend      string            // Name of a registered backend, the default one when empty
+
+	Retries         int           // Times a read statement is repeated after a transient error, 0 disables retries
+	RetryBackoff    time.Duration // Backoff before the first retry, doubled after every retry, 100ms when 0
+	RetryMaxBackoff time.Duration // Upper bound of the backoff between retries, 2s when 0
+
+	HostPolicy   string        // Order the hosts of Address are tried in: failover, roundrobin or random
+	HostCooldown time.Duration // Time a host which failed to connect is skipped, 30s when 0
+
+	TLSConfig string      // Value of the tls parameter: true, false, skip-verify or a name of RegisterTLSConfig
+	TLS       *tls.Config // TLS configuration of TLSConfig, nil when TLS is disabled
 }
 
 func NewConfig() *Config {
@@ -37,31 +55,63 @@ func NewConfig() *Config {
 		DialTimeout: time.Millisecond * 500,
 		Charset:     defaultCharset,
 		Location:    time.UTC,
+		ParseTime:   true,
 	}
 
 	return c
 }
 
+// HostAndPort returns the host and the port of Address, of its first host when it
+// lists several hosts. The default address is only used when Address is empty, an
+// invalid host (ParseDSN rejects them) is returned as it is with the port 0, so
+// that connecting to it fails.
 func (c *Config) HostAndPort() (string, int) {
-	if c.Address != "" {
-		parts := strings.Split(c.Address, ":")
-		if len(parts) != 2 {
-			return defaultHost, defaultPort
-		}
-		port, _ := strconv.Atoi(parts[1])
-		return parts[0], port
+	hosts := c.Hosts()
+	if len(hosts) == 0 {
+		return defaultHost, defaultPort
+	}
+	host, port, err := splitHost(hosts[0])
+	if err != nil {
+		return hosts[0], 0
 	}
-	return defaultHost, defaultPort
+	return host, port
 }
 
-// adjust represent adjust Config's field value from dsn params.
+// ParseError reports the part of a DSN which is invalid, errors.Is(err, InvalidDSN)
+// is true for it.
+type ParseError struct {
+	Part   string // user, password, protocol, address, dbname, parameter or the name of a parameter
+	Value  string // invalid text, never set for the password
+	Reason string
+}
+
+func (e *ParseError) Error() string {
+	if e.Value == "" {
+		return fmt.Sprintf("rtdb: invalid DSN: %s: %s", e.Part, e.Reason)
+	}
+	return fmt.Sprintf("rtdb: invalid DSN: %s %q: %s", e.Part, e.Value, e.Reason)
+}
+
+// Unwrap returns InvalidDSN.
+func (e *ParseError) Unwrap() error {
+	return InvalidDSN
+}
+
+// adjust applies the parameters of the DSN to the Config. Every known parameter is
+// applied, the unknown ones are only kept in Params.
 func (c *Config) adjust() error {
-	params := c.Params
-	if len(params) == 0 {
-		return nil
+	keys := make([]string, 0, len(c.Params))
+	for k := range c.Params {
+		keys = append(keys, k)
 	}
+	// report the same error for the same DSN
+	sort.Strings(keys)
 	var charset, loc, parseTime string
-	for k, v := range params {
+	for _, k := range keys {
+		v, err := url.QueryUnescape(c.Params[k])
+		if err != nil {
+			return &ParseError{Part: k, Value: c.Params[k], Reason: "invalid URL escape"}
+		}
 		switch k {
 		case "charset":
 			charset = v
@@ -69,34 +119,93 @@ func (c *Config) adjust() error {
 			parseTime = v
 		case "loc":
 			loc = v
+		case "timeout", "readTimeout", "writeTimeout":
+			timeout, err := time.ParseDuration(v)
+			if err != nil || timeout < 0 {
+				return &ParseError{Part: k, Value: v, Reason: "want a positive duration"}
+			}
+			switch k {
+			case "timeout":
+				c.DialTimeout = timeout
+			case "readTimeout":
+				c.ReadTimeout = timeout
+			default:
+				c.WriteTimeout = timeout
+			}
+		case "streamWindow":
+			window, err := time.ParseDuration(v)
+			if err != nil || window < 0 {
+				return &ParseError{Part: k, Value: v, Reason: "want a positive duration"}
+			}
+			c.StreamWindow = window
+		case "rawStrings":
+			raw, err := strconv.ParseBool(v)
+			if err != nil {
+				return &ParseError{Part: k, Value: v, Reason: "want a boolean"}
+			}
+			c.RawStrings = raw
+		case "retries":
+			retries, err := strconv.Atoi(v)
+			if err != nil || retries < 0 {
+				return &ParseError{Part: k, Value: v, Reason: "want a positive integer"}
+			}
+			c.Retries = retries
+		case "retryBackoff", "retryMaxBackoff":
+			backoff, err := time.ParseDuration(v)
+			if err != nil || backoff <= 0 {
+				return &ParseError{Part: k, Value: v, Reason: "want a positive duration"}
+			}
+			if k == "retryBackoff" {
+				c.RetryBackoff = backoff
+			} else {
+				c.RetryMaxBackoff = backoff
+			}
+		case "hostPolicy":
+			switch v {
+			case HostPolicyFailover, HostPolicyRoundRobin, HostPolicyRandom:
+				c.HostPolicy = v
+			default:
+				return &ParseError{Part: k, Value: v, Reason: "want failover, roundrobin or random"}
+			}
+		case "hostCooldown":
+			cooldown, err := time.ParseDuration(v)
+			if err != nil || cooldown <= 0 {
+				return &ParseError{Part: k, Value: v, Reason: "want a positive duration"}
+			}
+			c.HostCooldown = cooldown
+		case "tls":
+			config, err := parseTLS(v)
+			if err != nil {
+				return &ParseError{Part: k, Value: v, Reason: err.Error()}
+			}
+			c.TLSConfig, c.TLS = v, config
+		case "backend":
+			c.Backend = v
+		case "libPath":
+			c.LibPath = v
 		default:
-			// no option to adjust
-			return nil
+			// unknown parameters are kept in Params
 		}
 	}
-	if err := c.prepare(loc, charset, parseTime); err != nil {
-		return err
-	}
-
-	return nil
+	return c.prepare(loc, charset, parseTime)
 }
 
 func (c *Config) prepare(loc, charset, parseTime string) error {
 	if loc != "" {
 		if err := c.parseLoc(loc); err != nil {
-			return err
+			return &ParseError{Part: "loc", Value: loc, Reason: err.Error()}
 		}
-		c.ParseTime = c._parseTime
+		c.Location = c._loc
 	}
 	if charset != "" {
 		if err := c.parseCharset(charset); err != nil {
-			return err
+			return &ParseError{Part: "charset", Value: charset, Reason: err.Error()}
 		}
 		c.Charset = c._charset
 	}
 	if parseTime != "" {
 		if err := c.parseTime(parseTime); err != nil {
-			return err
+			return &ParseError{Part: "parseTime", Value: parseTime, Reason: err.Error()}
 		}
 		c.ParseTime = c._parseTime
 	}
@@ -119,11 +228,7 @@ func (pc *prepareConfig) revert() {
 }
 
 func (pc *prepareConfig) parseLoc(loc string) error {
-	v, err := url.QueryUnescape(loc)
-	if err != nil {
-		return err
-	}
-	loctmp, err := time.LoadLocation(v)
+	loctmp, err := time.LoadLocation(loc)
 	if err != nil {
 		return err
 	}
@@ -135,8 +240,7 @@ func (pc *prepareConfig) parseCharset(charset string) error {
 	charset = strings.ToLower(charset)
 	charsetId, ok := charsetMap[charset]
 	if !ok {
-		rtdbLogger.Printf("parse charset failed\n")
-		return InvalidDSN
+		return errors.New("unknown charset")
 	}
 	if charsetId != CHARSET_UNKNOWN {
 		pc._charset = charset
@@ -151,140 +255,267 @@ func (pc *prepareConfig) parseTime(parseTime string) error {
 	case "false", "f", "F", "False", "0":
 		pc._parseTime = false
 	default:
-		rtdbLogger.Printf("parse time failed\n")
-		return InvalidDSN
+		return errors.New("want a boolean")
 	}
 	return nil
 }
 
-// ParseDSN parses the dsn+ to a Config.
-// The DSN format is "{user}:{password}@{protocol}({host}:{port})/{dbname}?{param1}={value1}&{param2}={value2}"
-func ParseDSN(dsn string) (config *Config, err error) {
-	config = NewConfig()
-
-	foundLastSlash := false
-
-	// TODO: fix time zone bug
-	// var boudaryIndex int
-	// boudaryIndex = strings.LastIndex(dsn, "/")
-	// locIndex := strings.LastIndex(dsn, "loc")
-	// if boudaryIndex == -1 && len(dsn) > 0 {
-	// 	return nil, InvalidDSN
-	// }
-	// if boudaryIndex > 0 {
-	// 	if boudaryIndex > locIndex {
-	// 		lastSlashIndex := strings.LastIndex(dsn[:boudaryIndex], "/")
-	// 		if lastSlashIndex == -1 && len(dsn) > 0 {
-	// 			return nil, InvalidDSN
-	// 		}
-	// 		if lastSlashIndex == 0 {
-	// 			questionMarkIndex := strings.IndexByte(dsn, '?')
-	// 			// not found params
-	// 			if questionMarkIndex == -1 {
-	// 				config.DBName = dsn[1:]
-	// 			} else {
-	// 				config.DBName = dsn[1:questionMarkIndex]
-	// 				config.Params = parseDSNParams(dsn[questionMarkIndex+1:])
-	// 			}
-	// 		}
-	// 	}
-	// }
-	for i := len(dsn) - 1; i >= 0; i-- {
-		// how to handle time zone?? example .....Asia/Shanghai....
-		if dsn[i] == '/' {
-			foundLastSlash = true
-			if i > 0 {
-				lastSlashIndex := i
-				// deal with left part
-				var userInfoRightIndex int
-				// find the last '@'
-				for j := i - 1; j >= 0; j-- {
-					// find the host and port
-					if dsn[j] == '@' {
-						var lbracketsIndex, rbracketsIndex int
-						for k := lastSlashIndex - 1; k > j; k-- {
-							if dsn[k] == ')' {
-								rbracketsIndex = k
-							}
-							if dsn[k] == '(' {
-								lbracketsIndex = k
-							}
-						}
-						if lbracketsIndex >= 0 && rbracketsIndex > 0 {
-							config.Address = dsn[lbracketsIndex+1 : rbracketsIndex]
-							config.Protocol = dsn[j+1 : lbracketsIndex]
-						} else {
-							config.Protocol = dsn[j+1 : lastSlashIndex]
-						}
-						userInfoRightIndex = j
-						break
-					}
-				}
-				// find the first ':'
-				if userInfoRightIndex == 0 {
-					userInfoRightIndex = i
-				}
-				colonIndex := strings.IndexByte(dsn[:userInfoRightIndex], ':')
-				if colonIndex == -1 {
-					config.User = dsn[:userInfoRightIndex]
-				} else {
-					config.User = dsn[:colonIndex]
-					config.Password = dsn[colonIndex+1 : userInfoRightIndex]
-				}
-
-				// deal with the right part
-				// bug!!!这将会找到第一个问号而不是最后一个问号
-				// it will find question mark in the / right range
-				right := dsn[lastSlashIndex+1:]
-				questionMarkIndex := strings.IndexByte(right, '?')
-				if questionMarkIndex == -1 {
-					// not found params
-					config.DBName = dsn[lastSlashIndex+1:]
-				} else {
-					config.DBName = right[:questionMarkIndex]
-					config.Params = parseDSNParams(right[questionMarkIndex+1:])
-				}
-			} else {
-				// found '/' at zero index
-				questionMarkIndex := strings.IndexByte(dsn, '?')
-				// not found params
-				if questionMarkIndex == -1 {
-					config.DBName = dsn[1:]
-				} else {
-					config.DBName = dsn[1:questionMarkIndex]
-					config.Params = parseDSNParams(dsn[questionMarkIndex+1:])
-				}
+// ParseDSN parses the DSN to a Config. The DSN format is
+//
+//	[user[:password]@][protocol[(address)]]/dbname[?param1=value1&...&paramN=valueN]
+//
+// The user, the password and the dbname may be URL-escaped, the password may also
+// contain '@', ':' and '/': the user info ends at the last '@' which is followed by
+// a valid remainder of the DSN. The parameters start at the first '?' after the
+// dbname, their values may contain '/' and '=' and are URL-unescaped before they
+// are applied. An invalid DSN is reported with a *ParseError.
+func ParseDSN(dsn string) (*Config, error) {
+	config := NewConfig()
+	if dsn == "" {
+		return config, nil
+	}
+	err := config.parseTail(dsn)
+	// report the error of the last '@' when no remainder is valid
+	reported := err
+	for i := len(dsn); err != nil; {
+		if i = strings.LastIndexByte(dsn[:i], '@'); i < 0 {
+			return nil, reported
+		}
+		config = NewConfig()
+		if err = config.parseTail(dsn[i+1:]); err == nil {
+			err = config.parseUserInfo(dsn[:i])
+			reported = err
+			if err != nil {
+				return nil, err
 			}
-			break
+		} else if i == strings.LastIndexByte(dsn, '@') {
+			reported = err
 		}
 	}
-	if !foundLastSlash && len(dsn) > 0 {
-		rtdbLogger.Printf("slash not found\n")
-		return nil, InvalidDSN
-	}
 	if err := config.adjust(); err != nil {
 		return nil, err
 	}
 	return config, nil
 }
 
-func parseDSNParams(params string) map[string]string {
-	kv := make(map[string]string)
-	kvSlice := strings.Split(params, "&")
-	if len(kvSlice) == 0 {
-		return nil
+// dsnParams formats the fields of a Config set by the known DSN parameters.
+var dsnParams = map[string]func(c *Config) string{
+	"charset":         func(c *Config) string { return c.Charset },
+	"parseTime":       func(c *Config) string { return strconv.FormatBool(c.ParseTime) },
+	"loc":             func(c *Config) string { return c.Location.String() },
+	"timeout":         func(c *Config) string { return c.DialTimeout.String() },
+	"readTimeout":     func(c *Config) string { return c.ReadTimeout.String() },
+	"writeTimeout":    func(c *Config) string { return c.WriteTimeout.String() },
+	"rawStrings":      func(c *Config) string { return strconv.FormatBool(c.RawStrings) },
+	"streamWindow":    func(c *Config) string { return formatDuration(c.StreamWindow) },
+	"retries":         func(c *Config) string { return strconv.Itoa(c.Retries) },
+	"retryBackoff":    func(c *Config) string { return formatDuration(c.RetryBackoff) },
+	"retryMaxBackoff": func(c *Config) string { return formatDuration(c.RetryMaxBackoff) },
+	"hostPolicy":      func(c *Config) string { return c.HostPolicy },
+	"hostCooldown":    func(c *Config) string { return formatDuration(c.HostCooldown) },
+	"tls":             func(c *Config) string { return c.TLSConfig },
+	"backend":         func(c *Config) string { return c.Backend },
+	"libPath":         func(c *Config) string { return c.LibPath },
+}
+
+// formatDuration formats d, empty for 0 which is the default of the durations
+// that must be positive.
+func formatDuration(d time.Duration) string {
+	if d == 0 {
+		return ""
+	}
+	return d.String()
+}
+
+// FormatDSN formats the Config to a DSN, it is the inverse of ParseDSN. The
+// parameters of Params are kept as they are, a field which differs from the value
+// of its parameter, or from NewConfig when it has none, is added as a parameter.
+// ParseDSN returns the same fields, with the added parameters in Params.
+func (c *Config) FormatDSN() string {
+	var b strings.Builder
+	if c.User != "" || c.Password != "" {
+		b.WriteString(escapeDSN(c.User))
+		if c.Password != "" {
+			b.WriteString(":" + escapeDSN(c.Password))
+		}
+		b.WriteByte('@')
 	}
+	b.WriteString(c.Protocol)
+	if c.Address != "" {
+		b.WriteString("(" + c.Address + ")")
+	}
+	b.WriteString("/" + escapeDSN(c.DBName))
 
-	for _, kvStr := range kvSlice {
-		kvTmp := strings.Split(kvStr, "=")
-		if len(kvTmp) != 2 {
-			rtdbLogger.Printf("parse kv pair failed\n")
+	params := make(map[string]string, len(c.Params))
+	for k, v := range c.Params {
+		params[k] = v
+	}
+	defaults := NewConfig()
+	for k, format := range dsnParams {
+		value := format(c)
+		if raw, ok := params[k]; ok {
+			// keep the parameter when it sets the same value
+			parsed := NewConfig()
+			parsed.Params = map[string]string{k: raw}
+			if parsed.adjust() == nil && format(parsed) == value {
+				continue
+			}
+		} else if value == format(defaults) {
 			continue
 		}
-		kv[kvTmp[0]] = kvTmp[1]
+		params[k] = url.QueryEscape(value)
+	}
+	if c.Params == nil && len(params) == 0 {
+		return b.String()
+	}
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	b.WriteByte('?')
+	for i, k := range keys {
+		if i > 0 {
+			b.WriteByte('&')
+		}
+		b.WriteString(k + "=" + params[k])
+	}
+	return b.String()
+}
+
+// String returns the DSN of the config with the password redacted, so that a
+// printed Config does not leak it. Use FormatDSN to get the usable DSN.
+func (c *Config) String() string {
+	redacted := *c
+	if redacted.Password != "" {
+		redacted.Password = redactedSecret
+	}
+	return redactSecrets(redacted.FormatDSN())
+}
+
+// GoString is String, so that %#v does not print the password either.
+func (c *Config) GoString() string {
+	return c.String()
+}
+
+// escapeDSN escapes every character of s which is not unreserved in a URL, so that
+// s can not be taken for a delimiter of the DSN.
+func escapeDSN(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if isIdentByte(c) || c == '-' || c == '.' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// validate checks that the Config can be expressed by a DSN.
+func (c *Config) validate() error {
+	_, err := ParseDSN(c.FormatDSN())
+	return err
+}
+
+// parseUserInfo parses "user[:password]".
+func (c *Config) parseUserInfo(s string) error {
+	user, password := s, ""
+	if i := strings.IndexByte(s, ':'); i >= 0 {
+		user, password = s[:i], s[i+1:]
+	}
+	var err error
+	if c.User, err = url.PathUnescape(user); err != nil {
+		return &ParseError{Part: "user", Value: user, Reason: "invalid URL escape"}
+	}
+	if c.Password, err = url.PathUnescape(password); err != nil {
+		return &ParseError{Part: "password", Reason: "invalid URL escape"}
+	}
+	return nil
+}
+
+// parseTail parses the DSN after the user info, "[protocol[(address)]]/dbname[?params]".
+func (c *Config) parseTail(s string) error {
+	slash := strings.IndexByte(s, '/')
+	protocol := s
+	if open := strings.IndexByte(s, '('); open >= 0 && (slash < 0 || open < slash) {
+		end := strings.IndexByte(s[open:], ')')
+		if end < 0 {
+			return &ParseError{Part: "address", Value: s[open:], Reason: "missing ')'"}
+		}
+		end += open
+		protocol, c.Address = s[:open], s[open+1:end]
+		if strings.TrimSpace(c.Address) == "" {
+			return &ParseError{Part: "address", Value: s[open : end+1], Reason: "empty address"}
+		}
+		s = s[end+1:]
+		if !strings.HasPrefix(s, "/") {
+			return &ParseError{Part: "dbname", Value: s, Reason: "missing '/' after the address"}
+		}
+	} else {
+		if slash < 0 {
+			return &ParseError{Part: "dbname", Value: s, Reason: "missing '/'"}
+		}
+		protocol, s = s[:slash], s[slash:]
+	}
+	if protocol != "" {
+		if strings.IndexFunc(protocol, func(r rune) bool { return !isProtocolRune(r) }) >= 0 {
+			return &ParseError{Part: "protocol", Value: protocol, Reason: "invalid character"}
+		}
+		c.Protocol = protocol
+	}
+	if c.Protocol == "tcp" {
+		for _, host := range c.Hosts() {
+			if _, _, err := splitHost(host); err != nil {
+				return &ParseError{Part: "address", Value: host, Reason: err.Error()}
+			}
+		}
 	}
 
-	return kv
+	dbname, params := s[1:], ""
+	hasParams := false
+	if i := strings.IndexByte(dbname, '?'); i >= 0 {
+		dbname, params, hasParams = dbname[:i], dbname[i+1:], true
+	}
+	if strings.ContainsAny(dbname, "/@():") {
+		return &ParseError{Part: "dbname", Value: dbname, Reason: "invalid character, escape it"}
+	}
+	var err error
+	if c.DBName, err = url.PathUnescape(dbname); err != nil {
+		return &ParseError{Part: "dbname", Value: dbname, Reason: "invalid URL escape"}
+	}
+	if hasParams {
+		if c.Params, err = parseDSNParams(params); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func isProtocolRune(r rune) bool {
+	return r == '_' || r == '-' || r == '+' || r == '.' ||
+		(r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9')
+}
+
+// parseDSNParams splits "key1=value1&...&keyN=valueN", a value may contain '='.
+// The values are kept escaped, they are unescaped by adjust.
+func parseDSNParams(params string) (map[string]string, error) {
+	var kv map[string]string
+	for _, pair := range strings.Split(params, "&") {
+		if pair == "" {
+			continue
+		}
+		i := strings.IndexByte(pair, '=')
+		if i <= 0 {
+			return nil, &ParseError{Part: "parameter", Value: pair, Reason: "want key=value"}
+		}
+		if kv == nil {
+			kv = make(map[string]string)
+		}
+		kv[pair[:i]] = pair[i+1:]
+	}
+	return kv, nil
 }
 
 const (
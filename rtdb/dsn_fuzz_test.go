@@ -0,0 +1,30 @@
+//go:build go1.18
+// +build go1.18
+
+package rtdb
+
+import (
+	"reflect"
+	"testing"
+)
+
+// go test -run ^$ -fuzz ^FuzzParseDSN$ github.com/racetopdb/gortdb/rtdb
+func FuzzParseDSN(f *testing.F) {
+	for _, dsn := range dsnSeeds {
+		f.Add(dsn)
+	}
+	f.Fuzz(func(t *testing.T, dsn string) {
+		config, err := ParseDSN(dsn)
+		if err != nil {
+			return
+		}
+		formatted := config.FormatDSN()
+		again, err := ParseDSN(formatted)
+		if err != nil {
+			t.Fatalf("ParseDSN(%q) of %q: %v", formatted, dsn, err)
+		}
+		if !reflect.DeepEqual(again, config) {
+			t.Fatalf("ParseDSN(%q) = %+v, want %+v", formatted, again, config)
+		}
+	})
+}
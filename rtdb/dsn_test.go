@@ -1,6 +1,7 @@
 package rtdb
 
 import (
+	"errors"
 	"testing"
 	"time"
 
@@ -30,7 +31,7 @@ func TestParseDSN(t *testing.T) {
 				result *Config
 			}{
 				{"user:password@protocol(host:port)/dbname?param1=value1&param2=value2",
-					&Config{User: "user", Password: "password", Protocol: "protocol", Address: "host:port", DBName: "dbname", Charset: "iso-8859-1", Location: time.UTC, DialTimeout: time.Millisecond * 500, Params: map[string]string{
+					&Config{User: "user", Password: "password", Protocol: "protocol", Address: "host:port", DBName: "dbname", Charset: "iso-8859-1", Location: time.UTC, ParseTime: true, DialTimeout: time.Millisecond * 500, Params: map[string]string{
 						"param1": "value1",
 						"param2": "value2",
 					}}},
@@ -41,12 +42,12 @@ func TestParseDSN(t *testing.T) {
 						"loc":       "UTC",
 					}}},
 				{"root@unix(/path/to/socket)/myDB?charset=UTF-8",
-					&Config{User: "root", Protocol: "unix", Address: "/path/to/socket", DBName: "myDB", Charset: "utf-8", Location: time.UTC, DialTimeout: time.Millisecond * 500, Params: map[string]string{
+					&Config{User: "root", Protocol: "unix", Address: "/path/to/socket", DBName: "myDB", Charset: "utf-8", Location: time.UTC, ParseTime: true, DialTimeout: time.Millisecond * 500, Params: map[string]string{
 						"charset": "UTF-8",
 					}}},
 				{
 					"/dbname",
-					&Config{DBName: "dbname", Charset: "iso-8859-1", Location: time.UTC, DialTimeout: time.Millisecond * 500, Protocol: "tcp", Address: "127.0.0.1:9000"},
+					&Config{DBName: "dbname", Charset: "iso-8859-1", Location: time.UTC, DialTimeout: time.Millisecond * 500, Protocol: "tcp", Address: "127.0.0.1:9000", ParseTime: true},
 				},
 				{
 					"/dbname?parseTime=true&charset=UTF-8&loc=UTC",
@@ -58,6 +59,41 @@ func TestParseDSN(t *testing.T) {
 						Protocol:  "tcp", Address: "127.0.0.1:9000",
 					},
 				},
+				{
+					"/dbname?libPath=%2Fopt%2Ftsdb%2Flib",
+					&Config{DBName: "dbname", Charset: "iso-8859-1", Location: time.UTC, DialTimeout: time.Millisecond * 500, Params: map[string]string{
+						"libPath": "%2Fopt%2Ftsdb%2Flib"},
+						ParseTime: true,
+						Protocol:  "tcp", Address: "127.0.0.1:9000",
+						LibPath: "/opt/tsdb/lib",
+					},
+				},
+				{
+					"/dbname?retries=3&retryBackoff=50ms&retryMaxBackoff=1s",
+					&Config{DBName: "dbname", Charset: "iso-8859-1", Location: time.UTC, DialTimeout: time.Millisecond * 500, Params: map[string]string{
+						"retries": "3", "retryBackoff": "50ms", "retryMaxBackoff": "1s"},
+						ParseTime: true,
+						Protocol:  "tcp", Address: "127.0.0.1:9000",
+						Retries: 3, RetryBackoff: 50 * time.Millisecond, RetryMaxBackoff: time.Second,
+					},
+				},
+				{
+					"/dbname?timeout=1s&readTimeout=2s&writeTimeout=0",
+					&Config{DBName: "dbname", Charset: "iso-8859-1", Location: time.UTC, Params: map[string]string{
+						"timeout": "1s", "readTimeout": "2s", "writeTimeout": "0"},
+						ParseTime: true,
+						Protocol:  "tcp", Address: "127.0.0.1:9000",
+						DialTimeout: time.Second, ReadTimeout: 2 * time.Second,
+					},
+				},
+				{
+					"test:test@tcp(h1:9000,h2:9000)/dbname?hostPolicy=roundrobin&hostCooldown=10s",
+					&Config{User: "test", Password: "test", Protocol: "tcp", Address: "h1:9000,h2:9000", DBName: "dbname", Charset: "iso-8859-1", Location: time.UTC,
+						DialTimeout: time.Millisecond * 500, ParseTime: true, Params: map[string]string{
+							"hostPolicy": "roundrobin", "hostCooldown": "10s"},
+						HostPolicy: HostPolicyRoundRobin, HostCooldown: 10 * time.Second,
+					},
+				},
 			}
 			for _, testDSN := range testDSNs {
 				config, err = ParseDSN(testDSN.param)
@@ -66,5 +102,133 @@ func TestParseDSN(t *testing.T) {
 				So(config, ShouldResemble, testDSN.result)
 			}
 		})
+
+		Convey("Invalid retry, host and timeout parameters should be rejected", func(ctx C) {
+			for _, dsn := range []string{"/dbname?retries=-1", "/dbname?retries=a", "/dbname?retryBackoff=0s", "/dbname?retryMaxBackoff=1",
+				"/dbname?hostPolicy=first", "/dbname?hostCooldown=-1s", "/dbname?readTimeout=-1s", "/dbname?timeout=1"} {
+				_, err = ParseDSN(dsn)
+				So(errors.Is(err, InvalidDSN), ShouldBeTrue)
+			}
+		})
+
+		Convey("Special characters should be parsed into the right part", func(ctx C) {
+			config, err = ParseDSN("user:p@ss:w/rd@tcp(127.0.0.1:9000)/dbname?loc=Asia/Shanghai&opt=a=b&email=a@b")
+			So(err, ShouldBeNil)
+			So(config.User, ShouldEqual, "user")
+			So(config.Password, ShouldEqual, "p@ss:w/rd")
+			So(config.Address, ShouldEqual, "127.0.0.1:9000")
+			So(config.DBName, ShouldEqual, "dbname")
+			So(config.Location.String(), ShouldEqual, "Asia/Shanghai")
+			So(config.Params, ShouldResemble, map[string]string{"loc": "Asia/Shanghai", "opt": "a=b", "email": "a@b"})
+
+			config, err = ParseDSN("us%3Aer:p%40ss%3F@unix(/var/run/rtdb.sock)/my%2Fdb?libPath=%2Fopt%2Ftsdb")
+			So(err, ShouldBeNil)
+			So(config.User, ShouldEqual, "us:er")
+			So(config.Password, ShouldEqual, "p@ss?")
+			So(config.Protocol, ShouldEqual, "unix")
+			So(config.Address, ShouldEqual, "/var/run/rtdb.sock")
+			So(config.DBName, ShouldEqual, "my/db")
+			So(config.LibPath, ShouldEqual, "/opt/tsdb")
+		})
+
+		Convey("Unknown parameters should be kept while the known ones are applied", func(ctx C) {
+			config, err = ParseDSN("/dbname?zzz=1&aaa=2&parseTime=false&streamWindow=1h")
+			So(err, ShouldBeNil)
+			So(config.ParseTime, ShouldBeFalse)
+			So(config.StreamWindow, ShouldEqual, time.Hour)
+			So(config.Params["zzz"], ShouldEqual, "1")
+			So(config.Params["aaa"], ShouldEqual, "2")
+		})
+
+		Convey("Every host of the address should be validated", func(ctx C) {
+			config, err = ParseDSN("user:password@tcp([::1]:9000,db2:9001)/dbname")
+			So(err, ShouldBeNil)
+			host, port := config.HostAndPort()
+			So(host, ShouldEqual, "::1")
+			So(port, ShouldEqual, 9000)
+
+			_, err = ParseDSN("user:password@tcp(db1:9000,db2)/dbname")
+			var perr *ParseError
+			So(errors.As(err, &perr), ShouldBeTrue)
+			So(perr.Value, ShouldEqual, "db2")
+		})
+
+		Convey("The invalid part of the DSN should be reported", func(ctx C) {
+			var testDSNs = []struct {
+				dsn  string
+				part string
+			}{
+				{"user:password@tcp(127.0.0.1:9000", "address"},
+				{"user:password@tcp()/dbname", "address"},
+				{"user:password@tcp(db1:9000,db2)/dbname", "address"},
+				{"user:password@tcp(db1:90a0)/dbname", "address"},
+				{"user:password@tcp(db1:65536)/dbname", "address"},
+				{"user:password@tcp(::1:9000)/dbname", "address"},
+				{"user:password@tcp(:9000)/dbname", "address"},
+				{"user:password@tcp(127.0.0.1:9000)dbname", "dbname"},
+				{"user:password@tcp(127.0.0.1:9000)", "dbname"},
+				{"user:password@t c p/dbname", "protocol"},
+				{"user:password@tcp(h:1)/db(1)", "dbname"},
+				{"user:password@tcp(h:1)/dbname?parseTime", "parameter"},
+				{"us%zzer:password@tcp(h:1)/dbname", "user"},
+				{"user:pass%zz@tcp(h:1)/dbname", "password"},
+				{"/dbname?loc=Mars%2FOlympus", "loc"},
+				{"/dbname?charset=ebcdic", "charset"},
+				{"/dbname?parseTime=yes", "parseTime"},
+			}
+			for _, testDSN := range testDSNs {
+				_, err = ParseDSN(testDSN.dsn)
+				var perr *ParseError
+				So(errors.As(err, &perr), ShouldBeTrue)
+				So(perr.Part, ShouldEqual, testDSN.part)
+				So(errors.Is(err, InvalidDSN), ShouldBeTrue)
+			}
+			_, err = ParseDSN("user:secret%zz@tcp(h:1)/dbname")
+			So(err.Error(), ShouldNotContainSubstring, "secret")
+		})
+
+		Convey("FormatDSN should escape the Config and add its fields as parameters", func(ctx C) {
+			config := NewConfig()
+			config.User = "us:er"
+			config.Password = "p@ss/w?rd%"
+			config.Address = "h1:9000,h2:9000"
+			config.DBName = "db"
+			config.ParseTime = false
+			config.Location, _ = time.LoadLocation("Asia/Shanghai")
+			config.LibPath = "/opt/tsdb lib"
+			config.Retries = 2
+			dsn := config.FormatDSN()
+			So(dsn, ShouldEqual, "us%3Aer:p%40ss%2Fw%3Frd%25@tcp(h1:9000,h2:9000)/db?libPath=%2Fopt%2Ftsdb+lib&loc=Asia%2FShanghai&parseTime=false&retries=2")
+
+			parsed, err := ParseDSN(dsn)
+			So(err, ShouldBeNil)
+			parsed.Params = nil
+			So(parsed, ShouldResemble, config)
+
+			So(NewConfig().FormatDSN(), ShouldEqual, "tcp(127.0.0.1:9000)/")
+		})
+
+		Convey("A formatted Config should be parsed to the same Config", func(ctx C) {
+			for _, dsn := range dsnSeeds {
+				config, err = ParseDSN(dsn)
+				So(err, ShouldBeNil)
+				again, err := ParseDSN(config.FormatDSN())
+				So(err, ShouldBeNil)
+				So(again, ShouldResemble, config)
+			}
+		})
 	})
 }
+
+// dsnSeeds are valid DSNs for the round trip tests.
+var dsnSeeds = []string{
+	"",
+	"/dbname",
+	"user:password@protocol(host:port)/dbname?param1=value1&param2=value2",
+	"root:asd123456@tcp(127.0.0.1:9000)/myDB?parseTime=true&charset=UTF-8&loc=UTC",
+	"root@unix(/path/to/socket)/myDB?charset=UTF-8",
+	"user:p@ss:w/rd@tcp(h1:9000,h2:9000)/db?loc=Asia/Shanghai&opt=a=b",
+	"us%3Aer:p%40ss%3F@tcp(127.0.0.1:9000)/my%2Fdb?libPath=%2Fopt%2Ftsdb&hostPolicy=random",
+	":@/?",
+	"/db?charset=gbk&rawStrings=true",
+}
@@ -0,0 +1,164 @@
+package rtdb
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/racetopdb/gortdb/dll"
+)
+
+// libraryCacheEnv names the environment variable with the directory the embedded
+// libtsdb.so is extracted to.
+const libraryCacheEnv = "RTDB_LIB_CACHE_DIR"
+
+// embeddedFile is the open extracted library, it is loaded through its file
+// descriptor and kept open for the process.
+var embeddedFile *os.File
+
+// embeddedLibrary extracts the libtsdb.so embedded with the rtdb_embed build tag
+// and returns the path of its open file descriptor, empty when the binary has no
+// embedded library. The caller must hold nativeLibrary.mu.
+func embeddedLibrary() (string, error) {
+	data := dll.Libtsdb()
+	if len(data) == 0 {
+		return "", nil
+	}
+	dir := os.Getenv(libraryCacheEnv)
+	if dir == "" {
+		cacheDir, err := os.UserCacheDir()
+		if err != nil {
+			// the shared temporary directory needs a private directory of the user
+			cacheDir = filepath.Join(os.TempDir(), fmt.Sprintf("gortdb-%d", os.Getuid()))
+			if err := privateDir(cacheDir); err != nil {
+				return "", err
+			}
+		} else if err := os.MkdirAll(cacheDir, 0700); err != nil {
+			return "", err
+		}
+		dir = filepath.Join(cacheDir, "gortdb")
+	}
+	f, err := extractLibrary(data, dir)
+	if err != nil {
+		return "", err
+	}
+	if embeddedFile != nil {
+		embeddedFile.Close()
+	}
+	embeddedFile = f
+	// dlopen the verified file itself, its path could be swapped in between
+	return fmt.Sprintf("/proc/self/fd/%d", f.Fd()), nil
+}
+
+// privateDir creates the directory dir, or checks the existing one. It must be a
+// real directory, not a symbolic link, owned by the user and not accessible by
+// other users, so that no one else can swap the library in it.
+func privateDir(dir string) error {
+	if err := os.Mkdir(dir, 0700); err != nil && !os.IsExist(err) {
+		return err
+	}
+	info, err := os.Lstat(dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s: library cache directory is not a directory", dir)
+	}
+	if uid, ok := fileOwner(info); !ok || uid != os.Getuid() {
+		return fmt.Errorf("%s: library cache directory is not owned by the user", dir)
+	}
+	if info.Mode().Perm() != 0700 {
+		return fmt.Errorf("%s: library cache directory must have mode 0700", dir)
+	}
+	return nil
+}
+
+// extractLibrary writes data to a directory of dir named after its checksum and
+// returns the library opened for reading. A library already extracted is reused
+// when its checksum matches, otherwise it is replaced. dir and the directory of
+// the library must be private, see privateDir. The checksum is verified on the
+// returned file, which is the one to load.
+func extractLibrary(data []byte, dir string) (*os.File, error) {
+	sum := sha256.Sum256(data)
+	if err := privateDir(dir); err != nil {
+		return nil, err
+	}
+	dir = filepath.Join(dir, hex.EncodeToString(sum[:8]))
+	if err := privateDir(dir); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, libraryName)
+	if f, err := openVerified(path, sum[:]); err == nil {
+		return f, nil
+	}
+
+	// write to a temporary file first, a partial library is never loaded
+	f, err := os.CreateTemp(dir, libraryName+".*")
+	if err != nil {
+		return nil, err
+	}
+	tmp := f.Name()
+	defer os.Remove(tmp)
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(tmp, 0500); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return nil, err
+	}
+	return openVerified(path, sum[:])
+}
+
+// openVerified opens the library at path without following a symbolic link and
+// checks the open file: a regular file of the user, not writable by others, with
+// the SHA-256 checksum sum.
+func openVerified(path string, sum []byte) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_RDONLY|openNoFollow, 0)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyLibrary(f, sum); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+func verifyLibrary(f *os.File, sum []byte) error {
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("%s: library is not a regular file", f.Name())
+	}
+	if uid, ok := fileOwner(info); !ok || uid != os.Getuid() {
+		return fmt.Errorf("%s: library is not owned by the user", f.Name())
+	}
+	if info.Mode().Perm()&0022 != 0 {
+		return fmt.Errorf("%s: library is writable by other users", f.Name())
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return err
+	}
+	if !bytes.Equal(h.Sum(nil), sum) {
+		return fmt.Errorf("%s: checksum mismatch", f.Name())
+	}
+	_, err = f.Seek(0, io.SeekStart)
+	return err
+}
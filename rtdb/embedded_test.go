@@ -0,0 +1,91 @@
+package rtdb
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// go test -timeout 30s -run ^Test_extractLibrary$ github.com/racetopdb/gortdb/rtdb -v
+func Test_extractLibrary(t *testing.T) {
+	Convey("Test_extractLibrary", t, func(ctx C) {
+		dir := filepath.Join(t.TempDir(), "gortdb")
+		data := []byte("not really a shared library")
+
+		Convey("The library should be extracted to a private directory", func(ctx C) {
+			f, err := extractLibrary(data, dir)
+			So(err, ShouldBeNil)
+			defer f.Close()
+			So(filepath.Base(f.Name()), ShouldEqual, libraryName)
+			content, err := ioutil.ReadAll(f)
+			So(err, ShouldBeNil)
+			So(content, ShouldResemble, data)
+			info, err := os.Lstat(filepath.Dir(f.Name()))
+			So(err, ShouldBeNil)
+			So(info.Mode().Perm(), ShouldEqual, os.FileMode(0700))
+
+			again, err := extractLibrary(data, dir)
+			So(err, ShouldBeNil)
+			defer again.Close()
+			So(again.Name(), ShouldEqual, f.Name())
+		})
+
+		Convey("A corrupted library should be replaced", func(ctx C) {
+			f, err := extractLibrary(data, dir)
+			So(err, ShouldBeNil)
+			f.Close()
+			So(os.Chmod(f.Name(), 0600), ShouldBeNil)
+			So(ioutil.WriteFile(f.Name(), []byte("corrupted"), 0600), ShouldBeNil)
+
+			f, err = extractLibrary(data, dir)
+			So(err, ShouldBeNil)
+			defer f.Close()
+			content, err := ioutil.ReadAll(f)
+			So(err, ShouldBeNil)
+			So(content, ShouldResemble, data)
+		})
+
+		Convey("A symbolic link to the library should be replaced", func(ctx C) {
+			f, err := extractLibrary(data, dir)
+			So(err, ShouldBeNil)
+			f.Close()
+			other := filepath.Join(t.TempDir(), "other.so")
+			So(ioutil.WriteFile(other, []byte("corrupted"), 0500), ShouldBeNil)
+			So(os.Remove(f.Name()), ShouldBeNil)
+			So(os.Symlink(other, f.Name()), ShouldBeNil)
+
+			f, err = extractLibrary(data, dir)
+			So(err, ShouldBeNil)
+			defer f.Close()
+			info, err := os.Lstat(f.Name())
+			So(err, ShouldBeNil)
+			So(info.Mode().IsRegular(), ShouldBeTrue)
+		})
+
+		Convey("A directory accessible by other users should be rejected", func(ctx C) {
+			f, err := extractLibrary(data, dir)
+			So(err, ShouldBeNil)
+			f.Close()
+			So(os.Chmod(filepath.Dir(f.Name()), 0777), ShouldBeNil)
+			_, err = extractLibrary(data, dir)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("A directory created in advance with another mode should be rejected", func(ctx C) {
+			So(os.Mkdir(dir, 0755), ShouldBeNil)
+			So(os.Chmod(dir, 0755), ShouldBeNil)
+			_, err := extractLibrary(data, dir)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("A symbolic link as the directory should be rejected", func(ctx C) {
+			target := t.TempDir()
+			So(os.Symlink(target, dir), ShouldBeNil)
+			_, err := extractLibrary(data, dir)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -1,7 +1,13 @@
 package rtdb
 
 import (
+	"context"
+	"database/sql/driver"
 	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
 )
 
 var (
@@ -11,7 +17,41 @@ var (
 	OutOfMemory   = errors.New("rtdb: out of memory")
 	NoAccess      = errors.New("rtdb: insufficient permissions")
 	ProtocolError = errors.New("rtdb: protocol processing error")
-	// TODO: Error should be designed for DSN
+	// TxDone is returned when Commit or Rollback is called on a finished transaction.
+	TxDone = errors.New("rtdb: transaction has already been committed or rolled back")
+	// TxIsolationNotSupported is returned by BeginTx for any non-default isolation level.
+	TxIsolationNotSupported = errors.New("rtdb: transaction isolation level is not supported")
+	// TxReadOnlyNotSupported is returned by BeginTx for read-only transactions.
+	TxReadOnlyNotSupported = errors.New("rtdb: read-only transaction is not supported")
+	// TxNested is returned by BeginTx when a transaction is already running on the connection.
+	TxNested = errors.New("rtdb: transaction is already running")
+	// InvalidBinaryCell is returned when a BINARY column of a result set has no
+	// length, the length of its values can not be determined.
+	InvalidBinaryCell = errors.New("rtdb: BINARY column has no length")
+	// BinaryArgsUnsupported is returned when a non-nil []byte is bound to a
+	// placeholder, the syntax of binary literals of the server is not documented.
+	BinaryArgsUnsupported = errors.New("rtdb: []byte arguments are not supported, the binary literal of the server is not documented")
+	// TxResultUnknown is returned by the result of a write statement buffered by a
+	// transaction, the statement has not been executed yet.
+	TxResultUnknown = errors.New("rtdb: result of a statement buffered by a transaction is unknown")
+	// LibraryUnavailable is returned when libtsdb.so can not be loaded, it is wrapped
+	// with the paths which have been tried.
+	LibraryUnavailable = errors.New("rtdb: libtsdb.so can not be loaded")
+	// LibraryIncompatible is returned when the interface version of libtsdb.so is
+	// older than the lowest version supported by the driver.
+	LibraryIncompatible = errors.New("rtdb: libtsdb.so is incompatible")
+	// LibraryConflict is returned when the libPath of a DSN names another library
+	// than the libtsdb.so already loaded by the process, which can not be replaced.
+	LibraryConflict = errors.New("rtdb: libPath differs from the libtsdb.so already loaded")
+	// ErrNativeUnavailable is returned by Connect when the driver is built without cgo
+	// (CGO_ENABLED=0) and no pure-Go backend is registered.
+	ErrNativeUnavailable = errors.New("rtdb: native backend is unavailable, the driver is built without cgo; register a backend with rtdb.RegisterBackend")
+	// TLSUnsupported is returned by Connect when the DSN enables TLS with the native
+	// backend, the error wrapping it names the library. libtsdb documents no TLS
+	// parameters of its connection string, so the native backend does not
+	// support TLS yet.
+	TLSUnsupported = errors.New("rtdb: TLS is not supported by libtsdb.so, remove the tls parameter or use a backend which supports it")
+	// InvalidDSN is wrapped by the *ParseError describing the invalid part of a DSN.
 	InvalidDSN = errors.New("rtdb: invalid DSN")
 )
 
@@ -50,5 +90,232 @@ const (
 	EDOM    = 33 /* Math argument out of domain of func */
 	ERANGE  = 34 /* Math result not representable */
 
-	EPROTO = 71
+	EPROTO       = 71  /* Protocol error */
+	ENETDOWN     = 100 /* Network is down */
+	ENETUNREACH  = 101 /* Network is unreachable */
+	ENETRESET    = 102 /* Network dropped connection because of reset */
+	ECONNABORTED = 103 /* Software caused connection abort */
+	ECONNRESET   = 104 /* Connection reset by peer */
+	ENOTCONN     = 107 /* Transport endpoint is not connected */
+	ETIMEDOUT    = 110 /* Connection timed out */
+	ECONNREFUSED = 111 /* Connection refused */
+	EHOSTDOWN    = 112 /* Host is down */
+	EHOSTUNREACH = 113 /* No route to host */
 )
+
+// errnoNames are the names of the error codes above.
+var errnoNames = map[int]string{
+	EPERM: "EPERM", ENOENT: "ENOENT", ESRCH: "ESRCH", EINTR: "EINTR", ENXIO: "ENXIO",
+	E2BIG: "E2BIG", ENOEXEC: "ENOEXEC", EBADF: "EBADF", ECHILD: "ECHILD", EAGAIN: "EAGAIN",
+	ENOMEM: "ENOMEM", EACCES: "EACCES", EFAULT: "EFAULT", ENOTBLK: "ENOTBLK", EBUSY: "EBUSY",
+	EEXIST: "EEXIST", EXDEV: "EXDEV", ENODEV: "ENODEV", ENOTDIR: "ENOTDIR", EISDIR: "EISDIR",
+	EINVAL: "EINVAL", ENFILE: "ENFILE", EMFILE: "EMFILE", ENOTTY: "ENOTTY", ETXTBSY: "ETXTBSY",
+	EFBIG: "EFBIG", ENOSPC: "ENOSPC", ESPIPE: "ESPIPE", EROFS: "EROFS", EMLINK: "EMLINK",
+	EPIPE: "EPIPE", EDOM: "EDOM", ERANGE: "ERANGE", EPROTO: "EPROTO",
+	ENETDOWN: "ENETDOWN", ENETUNREACH: "ENETUNREACH", ENETRESET: "ENETRESET",
+	ECONNABORTED: "ECONNABORTED", ECONNRESET: "ECONNRESET", ENOTCONN: "ENOTCONN",
+	ETIMEDOUT: "ETIMEDOUT", ECONNREFUSED: "ECONNREFUSED", EHOSTDOWN: "EHOSTDOWN",
+	EHOSTUNREACH: "EHOSTUNREACH",
+}
+
+// networkErrnos are the error codes of a broken connection to the server.
+var networkErrnos = map[int]bool{
+	EPIPE: true, ENETDOWN: true, ENETUNREACH: true, ENETRESET: true, ECONNABORTED: true,
+	ECONNRESET: true, ENOTCONN: true, ETIMEDOUT: true, ECONNREFUSED: true, EHOSTDOWN: true,
+	EHOSTUNREACH: true,
+}
+
+// operations of libtsdb reported by Error.Op, tsdb_store_result_v2 returns no
+// error code and a failed store is reported by the free of the previous result.
+const (
+	opConnect    = "connect"
+	opDisconnect = "disconnect"
+	opQuery      = "query"
+	opFree       = "free"
+)
+
+// maxErrorSQLLen is the length the statement of an Error is truncated to.
+const maxErrorSQLLen = 256
+
+// Error is an error code returned by libtsdb. errors.Is reports the sentinel
+// error of the code (InvalidArgs, NoAccess, OutOfMemory or ProtocolError), and
+// driver.ErrBadConn for the codes of a broken connection, so that database/sql
+// discards the connection and runs the call again on another one. A statement
+// which changes data may have been applied before the connection broke, its
+// error does not report driver.ErrBadConn, so it is never run twice.
+type Error struct {
+	Code int    // error code returned by libtsdb, an errno value
+	Name string // name of the code, e.g. "EPIPE", empty when unknown
+	Op   string // operation which failed: connect, disconnect, query or free
+	SQL  string // statement of a query with its literals redacted
+
+	mayBeApplied bool // the failed statement changes data and may have been applied
+}
+
+// newError returns the Error of a libtsdb call, nil when code is 0.
+func newError(op string, code int, sql string) error {
+	if code == 0 {
+		return nil
+	}
+	return &Error{Code: code, Name: errnoNames[code], Op: op, SQL: redactSQL(sql)}
+}
+
+func (e *Error) Error() string {
+	var b strings.Builder
+	b.WriteString(e.Unwrap().Error())
+	fmt.Fprintf(&b, ": %s failed with ", e.Op)
+	if e.Name != "" {
+		fmt.Fprintf(&b, "%s (%d)", e.Name, e.Code)
+	} else {
+		fmt.Fprintf(&b, "code %d", e.Code)
+	}
+	if e.SQL != "" {
+		fmt.Fprintf(&b, ", sql: %s", e.SQL)
+	}
+	return b.String()
+}
+
+// Unwrap returns the sentinel error of the code.
+func (e *Error) Unwrap() error {
+	return convertErr(e.Code)
+}
+
+// Is reports driver.ErrBadConn for the codes of a broken connection, unless the
+// failed statement may have been applied.
+func (e *Error) Is(target error) bool {
+	return target == driver.ErrBadConn && e.Network() && !e.mayBeApplied
+}
+
+// Temporary reports whether the call has been interrupted or the server is busy,
+// so that it may succeed when it is repeated.
+func (e *Error) Temporary() bool {
+	return e.Code == EAGAIN || e.Code == EINTR || e.Code == EBUSY
+}
+
+// Network reports whether the code is the one of a broken connection.
+func (e *Error) Network() bool {
+	return networkErrnos[e.Code]
+}
+
+// TimeoutError is returned when a native call exceeds Config.DialTimeout,
+// ReadTimeout or WriteTimeout, errors.Is(err, context.DeadlineExceeded) is true.
+// The timeouts are enforced by the driver only, the connection string of libtsdb
+// takes no timeout (see buildConnStr) and the call can not be aborted: the statement keeps running on the server and the
+// native call keeps holding the process wide session (see sessionManager) until
+// it returns, the connection is quarantined like for the deadline of a context.
+type TimeoutError struct {
+	Op    string        // dial, read or write
+	Limit time.Duration // timeout which has expired
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("rtdb: %s timeout after %v", e.Op, e.Limit)
+}
+
+// Is reports context.DeadlineExceeded.
+func (e *TimeoutError) Is(target error) bool {
+	return target == context.DeadlineExceeded
+}
+
+// Timeout reports true, like the timeouts of the net package.
+func (e *TimeoutError) Timeout() bool {
+	return true
+}
+
+// CommitError is returned by Commit when a buffered statement failed. The Applied
+// statements before it have been executed and are not rolled back, the following
+// ones have not been sent.
+type CommitError struct {
+	Applied int   // statements executed before the failure
+	Total   int   // statements of the transaction
+	Err     error // error of the failing statement
+}
+
+func (e *CommitError) Error() string {
+	return fmt.Sprintf("rtdb: commit failed after %d of %d statements: %v", e.Applied, e.Total, e.Err)
+}
+
+func (e *CommitError) Unwrap() error {
+	return e.Err
+}
+
+// redactSQL replaces the string and number literals of sql with "?" and truncates
+// it, so that errors and logs do not leak the data of the statement.
+func redactSQL(sql string) string {
+	var b strings.Builder
+	for i := 0; i < len(sql); i++ {
+		c := sql[i]
+		switch {
+		case c == '\'':
+			// skip to the closing quote, '' and \' are escaped quotes
+			for i++; i < len(sql); i++ {
+				if sql[i] == '\\' {
+					i++
+				} else if sql[i] == '\'' {
+					if i+1 < len(sql) && sql[i+1] == '\'' {
+						i++
+						continue
+					}
+					break
+				}
+			}
+			b.WriteByte('?')
+		case isDigit(c) && (i == 0 || !isIdentByte(sql[i-1])):
+			for i+1 < len(sql) && (isIdentByte(sql[i+1]) || sql[i+1] == '.') {
+				i++
+			}
+			b.WriteByte('?')
+		default:
+			b.WriteByte(c)
+		}
+	}
+	redacted := b.String()
+	if len(redacted) > maxErrorSQLLen {
+		redacted = redacted[:maxErrorSQLLen] + "..."
+	}
+	return redacted
+}
+
+// redactedSecret replaces the secrets in errors and logs.
+const redactedSecret = "xxxxx"
+
+var (
+	// passwd=secret of the connection string and password=secret of a DSN
+	secretParamRegexp = regexp.MustCompile(`(?i)\b(passw(?:or)?d=)[^;&\s]*`)
+	// the quoted password of CREATE USER / ALTER USER statements
+	secretSQLRegexp = regexp.MustCompile(`(?i)\b((?:password|identified\s+by)\s*)('(?:[^'\\]|\\.|'')*'|"(?:[^"\\]|\\.)*")`)
+)
+
+// redactSecrets replaces the passwords of connection strings and SQL statements
+// in s, it is applied to every log line.
+func redactSecrets(s string) string {
+	s = secretParamRegexp.ReplaceAllString(s, "${1}"+redactedSecret)
+	return secretSQLRegexp.ReplaceAllString(s, "${1}'"+redactedSecret+"'")
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentByte(c byte) bool {
+	return isDigit(c) || c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// convertErr returns the sentinel error of an error code of libtsdb.
+func convertErr(errCode int) error {
+	noErrCode := 0
+	switch errCode {
+	case noErrCode:
+		return nil
+	case EINVAL:
+		return InvalidArgs
+	case EACCES:
+		return NoAccess
+	case ENOMEM:
+		return OutOfMemory
+	case EPROTO:
+		return ProtocolError
+	default:
+		return ProtocolError
+	}
+}
@@ -0,0 +1,57 @@
+package rtdb
+
+import (
+	"database/sql/driver"
+	"errors"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// go test -timeout 30s -run ^TestError$ github.com/racetopdb/gortdb/rtdb -v
+func TestError(t *testing.T) {
+	Convey("TestError", t, func(ctx C) {
+		Convey("A zero code should not be an error", func(ctx C) {
+			So(newError(opQuery, 0, "select 1"), ShouldBeNil)
+		})
+
+		Convey("The code should keep its sentinel error", func(ctx C) {
+			err := newError(opQuery, EINVAL, "select * from t where name = 'secret'")
+			So(errors.Is(err, InvalidArgs), ShouldBeTrue)
+			So(errors.Is(err, driver.ErrBadConn), ShouldBeFalse)
+			So(err, ShouldBeError, "rtdb: invalid args: query failed with EINVAL (22), sql: select * from t where name = ?")
+
+			var rerr *Error
+			So(errors.As(err, &rerr), ShouldBeTrue)
+			So(rerr.Code, ShouldEqual, EINVAL)
+			So(rerr.Name, ShouldEqual, "EINVAL")
+			So(rerr.Op, ShouldEqual, opQuery)
+		})
+
+		Convey("Network codes should be bad connections", func(ctx C) {
+			for _, code := range []int{EPIPE, ECONNRESET, ETIMEDOUT} {
+				err := newError(opConnect, code, "")
+				So(errors.Is(err, driver.ErrBadConn), ShouldBeTrue)
+				So(errors.Is(err, ProtocolError), ShouldBeTrue)
+			}
+			So(errors.Is(newError(opQuery, EAGAIN, ""), driver.ErrBadConn), ShouldBeFalse)
+			So(errors.Is(newError(opQuery, ENOSPC, ""), driver.ErrBadConn), ShouldBeFalse)
+		})
+
+		Convey("Unknown codes should be reported by number", func(ctx C) {
+			So(newError(opFree, -1, ""), ShouldBeError, "rtdb: protocol processing error: free failed with code -1")
+		})
+	})
+}
+
+// go test -timeout 30s -run ^Test_redactSQL$ github.com/racetopdb/gortdb/rtdb -v
+func Test_redactSQL(t *testing.T) {
+	Convey("Test_redactSQL", t, func(ctx C) {
+		So(redactSQL("insert into t1(id, name) values(12, 'it''s \\'a\\' secret')"), ShouldEqual, "insert into t1(id, name) values(?, ?)")
+		So(redactSQL("select * from t2 where time between '2021-01-01' and '2021-01-02' and v > -1.5e3"), ShouldEqual,
+			"select * from t2 where time between ? and ? and v > -?")
+		So(redactSQL("select * from t where name = 'unterminated"), ShouldEqual, "select * from t where name = ?")
+		long := redactSQL(string(make([]byte, maxErrorSQLLen+10)))
+		So(len(long), ShouldEqual, maxErrorSQLLen+3)
+	})
+}
@@ -3,21 +3,23 @@ package rtdb
 import (
 	"database/sql"
 	"reflect"
+	"time"
 )
 
-type fieldType uint8
+// FieldType is the data type of a column, it has the values of tsdb_ml_field_t.data_type.
+type FieldType uint8
 
 const (
-	fieldTypeUnknown fieldType = iota
-	fieldTypeBool
-	fieldTypeInt
-	fieldTypeInt64
-	fieldTypeFloat
-	fieldTypeDouble
-	fieldTypeBinary
-	fieldTypeString
-	fieldTypeDatetime
-	fieldTypeNull
+	FieldTypeUnknown FieldType = iota
+	FieldTypeBool
+	FieldTypeInt
+	FieldTypeInt64
+	FieldTypeFloat
+	FieldTypeDouble
+	FieldTypeBinary
+	FieldTypeString
+	FieldTypeDatetime
+	FieldTypeNull
 )
 
 var (
@@ -35,77 +37,106 @@ var (
 	scanTypeInt      = reflect.TypeOf(int(0))
 	scanTypeBool     = reflect.TypeOf(bool(false))
 	scanTypeRawBytes = reflect.TypeOf(sql.RawBytes{})
+	scanTypeBytes    = reflect.TypeOf([]byte{})
+	scanTypeTime     = reflect.TypeOf(time.Time{})
 
-	scanTypeNullFloat = reflect.TypeOf(sql.NullFloat64{})
-	scanTypeNullInt   = reflect.TypeOf(sql.NullInt64{})
-	scanTypeNullTime  = reflect.TypeOf(sql.NullTime{})
-	scanTypeNullBool  = reflect.TypeOf(sql.NullBool{})
+	scanTypeNullFloat  = reflect.TypeOf(sql.NullFloat64{})
+	scanTypeNullInt    = reflect.TypeOf(sql.NullInt64{})
+	scanTypeNullTime   = reflect.TypeOf(sql.NullTime{})
+	scanTypeNullBool   = reflect.TypeOf(sql.NullBool{})
+	scanTypeNullString = reflect.TypeOf(sql.NullString{})
 )
 
-type rtdbField struct {
-	name      string
-	len       uint8
-	fieldType fieldType
-	charset   uint8
-	isNull    bool
-	varLen    uint8 // for variable length data structure
+// Field describes a column of a result set.
+type Field struct {
+	Name       string
+	Length     uint8
+	Type       FieldType
+	Charset    uint8
+	Nullable   bool
+	RealLength uint8 // for variable length data structure
 }
 
-func (rf *rtdbField) scanType() reflect.Type {
-	switch rf.fieldType {
-	case fieldTypeUnknown:
+func (rf *Field) scanType() reflect.Type {
+	switch rf.Type {
+	case FieldTypeUnknown:
 		return scanTypeUnknown
-	case fieldTypeBool:
-		if rf.isNull {
+	case FieldTypeBool:
+		if rf.Nullable {
 			return scanTypeNullBool
 		}
 		return scanTypeBool
-	case fieldTypeInt:
-		if rf.isNull {
+	case FieldTypeInt:
+		if rf.Nullable {
 			return scanTypeNullInt
 		}
 		return scanTypeInt
-	case fieldTypeInt64:
-		if rf.isNull {
+	case FieldTypeInt64:
+		if rf.Nullable {
 			return scanTypeNullInt
 		}
 		return scanTypeInt64
-	case fieldTypeFloat:
-		if rf.isNull {
+	case FieldTypeFloat:
+		if rf.Nullable {
 			return scanTypeNullFloat
 		}
 		return scanTypeFloat32
-	case fieldTypeDouble:
-		if rf.isNull {
+	case FieldTypeDouble:
+		if rf.Nullable {
 			return scanTypeNullFloat
 		}
 		return scanTypeFloat64
-	case fieldTypeBinary, fieldTypeString:
+	case FieldTypeBinary:
+		return scanTypeBytes
+	case FieldTypeDatetime:
+		if rf.Nullable {
+			return scanTypeNullTime
+		}
+		return scanTypeTime
+	case FieldTypeString:
+		if rf.Nullable {
+			return scanTypeNullString
+		}
 		return scanTypeRawBytes
 	default:
 		return scanTypeUnknown
 	}
 }
 
-func (rf *rtdbField) typeDatabaseTypeName() string {
-	switch rf.fieldType {
-	case fieldTypeBool:
+func (rf *Field) typeDatabaseTypeName() string {
+	switch rf.Type {
+	case FieldTypeBool:
 		return "BOOL"
-	case fieldTypeDatetime:
+	case FieldTypeDatetime:
 		return "DATETIME"
-	case fieldTypeFloat:
+	case FieldTypeFloat:
 		return "FLOAT"
-	case fieldTypeDouble:
+	case FieldTypeDouble:
 		return "DOUBLE"
-	case fieldTypeString:
+	case FieldTypeString:
 		return "STRING"
-	case fieldTypeInt:
+	case FieldTypeBinary:
+		return "BINARY"
+	case FieldTypeInt:
 		return "INT"
-	case fieldTypeInt64:
+	case FieldTypeInt64:
 		return "INT64"
-	case fieldTypeNull:
+	case FieldTypeNull:
 		return "NULL"
 	default:
 		return ""
 	}
 }
+
+// binaryLen returns the byte length of the values of a BINARY column: the real
+// length libtsdb reports for the field, or its declared length. libtsdb reports no
+// length of the single values, the cells of a row are not used to guess one.
+func (rf *Field) binaryLen() (int, error) {
+	if rf.RealLength > 0 {
+		return int(rf.RealLength), nil
+	}
+	if rf.Length > 0 {
+		return int(rf.Length), nil
+	}
+	return 0, InvalidBinaryCell
+}
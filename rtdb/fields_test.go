@@ -0,0 +1,72 @@
+package rtdb
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// go test -timeout 30s -run ^Test_rtdbField_scanType$ github.com/racetopdb/gortdb/rtdb -v
+func Test_rtdbField_scanType(t *testing.T) {
+	Convey("Test_rtdbField_scanType", t, func(ctx C) {
+		Convey("Binary columns should be scanned to []byte", func(ctx C) {
+			field := &Field{Type: FieldTypeBinary}
+			So(field.scanType(), ShouldEqual, reflect.TypeOf([]byte{}))
+			So(field.typeDatabaseTypeName(), ShouldEqual, "BINARY")
+		})
+	})
+}
+
+// go test -timeout 30s -run ^Test_rtdbField_binaryLen$ github.com/racetopdb/gortdb/rtdb -v
+func Test_rtdbField_binaryLen(t *testing.T) {
+	Convey("Test_rtdbField_binaryLen", t, func(ctx C) {
+		Convey("The length reported by libtsdb should be used", func(ctx C) {
+			n, err := (&Field{Type: FieldTypeBinary, Length: 16, RealLength: 8}).binaryLen()
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 8)
+			n, err = (&Field{Type: FieldTypeBinary, Length: 16}).binaryLen()
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 16)
+		})
+
+		Convey("A column without a length should be rejected", func(ctx C) {
+			_, err := (&Field{Type: FieldTypeBinary}).binaryLen()
+			So(err, ShouldEqual, InvalidBinaryCell)
+		})
+	})
+}
+
+// go test -timeout 30s -run ^Test_rtdbRows_ColumnTypeNullable$ github.com/racetopdb/gortdb/rtdb -v
+func Test_rtdbRows_ColumnTypeNullable(t *testing.T) {
+	Convey("Test_rtdbRows_ColumnTypeNullable", t, func(ctx C) {
+		rows := &rtdbRows{rc: &rtdbConn{config: NewConfig()}}
+		rows.resultSet.columns = []Field{
+			{Name: "time", Type: FieldTypeDatetime},
+			{Name: "age", Type: FieldTypeInt, Nullable: true},
+			{Name: "score", Type: FieldTypeDouble, Nullable: true},
+			{Name: "name", Type: FieldTypeString, Nullable: true},
+			{Name: "ok", Type: FieldTypeBool, Nullable: true},
+			{Name: "at", Type: FieldTypeDatetime, Nullable: true},
+		}
+		Convey("Nullable should match the is_null flag of the field", func(ctx C) {
+			nullable, ok := rows.ColumnTypeNullable(0)
+			So(ok, ShouldBeTrue)
+			So(nullable, ShouldBeFalse)
+			nullable, ok = rows.ColumnTypeNullable(1)
+			So(ok, ShouldBeTrue)
+			So(nullable, ShouldBeTrue)
+		})
+
+		Convey("Nullable columns should be scanned to sql.Null* types", func(ctx C) {
+			So(rows.ColumnTypeScanType(0), ShouldEqual, reflect.TypeOf(time.Time{}))
+			So(rows.ColumnTypeScanType(1), ShouldEqual, reflect.TypeOf(sql.NullInt64{}))
+			So(rows.ColumnTypeScanType(2), ShouldEqual, reflect.TypeOf(sql.NullFloat64{}))
+			So(rows.ColumnTypeScanType(3), ShouldEqual, reflect.TypeOf(sql.NullString{}))
+			So(rows.ColumnTypeScanType(4), ShouldEqual, reflect.TypeOf(sql.NullBool{}))
+			So(rows.ColumnTypeScanType(5), ShouldEqual, reflect.TypeOf(sql.NullTime{}))
+		})
+	})
+}
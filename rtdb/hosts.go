@@ -0,0 +1,145 @@
+package rtdb
+
+import (
+	"database/sql"
+	"errors"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// host policies of the hostPolicy DSN parameter
+const (
+	// HostPolicyFailover connects to the first host which is up, in the order of the DSN.
+	HostPolicyFailover = "failover"
+	// HostPolicyRoundRobin starts every connection with the host after the previous one.
+	HostPolicyRoundRobin = "roundrobin"
+	// HostPolicyRandom starts every connection with a random host.
+	HostPolicyRandom = "random"
+)
+
+// defaultHostCooldown is the time a host which failed to connect is skipped.
+const defaultHostCooldown = 30 * time.Second
+
+// Hosts returns the addresses of Config.Address, which lists several hosts
+// separated by commas, e.g. "h1:9000,h2:9000".
+func (c *Config) Hosts() []string {
+	var hosts []string
+	for _, host := range strings.Split(c.Address, ",") {
+		if host = strings.TrimSpace(host); host != "" {
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts
+}
+
+// splitHost splits a host of Config.Address into its name and port, the port is
+// required and IPv6 addresses are enclosed in brackets, e.g. "[::1]:9000".
+func splitHost(host string) (string, int, error) {
+	name, port, err := net.SplitHostPort(host)
+	if err != nil {
+		return "", 0, errors.New("want host:port")
+	}
+	if name == "" {
+		return "", 0, errors.New("missing host")
+	}
+	n, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return "", 0, errors.New("want a port from 0 to 65535")
+	}
+	return name, int(n), nil
+}
+
+// hostPool orders the hosts of a connector by Config.HostPolicy and keeps the
+// hosts which are down.
+type hostPool struct {
+	mu       sync.Mutex
+	hosts    []string
+	policy   string
+	cooldown time.Duration
+	next     int                  // first host of the next connection for roundrobin
+	down     map[string]time.Time // hosts which are skipped until the time
+	now      func() time.Time
+}
+
+func newHostPool(c *Config) *hostPool {
+	hosts := c.Hosts()
+	if len(hosts) == 0 {
+		hosts = []string{c.Address}
+	}
+	cooldown := c.HostCooldown
+	if cooldown <= 0 {
+		cooldown = defaultHostCooldown
+	}
+	return &hostPool{
+		hosts:    hosts,
+		policy:   c.HostPolicy,
+		cooldown: cooldown,
+		down:     make(map[string]time.Time),
+		now:      time.Now,
+	}
+}
+
+// order returns the hosts in the order they are tried by the next connection,
+// the hosts which are up first. The hosts which are down are still tried last,
+// so that a connection is attempted when every host is down.
+func (p *hostPool) order() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	ordered := make([]string, len(p.hosts))
+	switch p.policy {
+	case HostPolicyRoundRobin:
+		for i := range p.hosts {
+			ordered[i] = p.hosts[(p.next+i)%len(p.hosts)]
+		}
+		p.next = (p.next + 1) % len(p.hosts)
+	case HostPolicyRandom:
+		for i, j := range rand.Perm(len(p.hosts)) {
+			ordered[i] = p.hosts[j]
+		}
+	default:
+		copy(ordered, p.hosts)
+	}
+	now := p.now()
+	up := ordered[:0:0]
+	var down []string
+	for _, host := range ordered {
+		if until, ok := p.down[host]; ok && now.Before(until) {
+			down = append(down, host)
+			continue
+		}
+		delete(p.down, host)
+		up = append(up, host)
+	}
+	return append(up, down...)
+}
+
+// markDown skips host for the cooldown of the pool.
+func (p *hostPool) markDown(host string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.down[host] = p.now().Add(p.cooldown)
+}
+
+// ConnInfo describes a connection of the driver, see ConnectionInfo.
+type ConnInfo struct {
+	Host string // address of the server the connection is logged in to
+}
+
+// ConnectionInfo returns the information of conn, which must be a connection of
+// the rtdb driver.
+func ConnectionInfo(conn *sql.Conn) (ConnInfo, error) {
+	var info ConnInfo
+	err := conn.Raw(func(driverConn interface{}) error {
+		rc, ok := driverConn.(*rtdbConn)
+		if !ok {
+			return errors.New("rtdb: not a connection of the rtdb driver")
+		}
+		info.Host = rc.config.Address
+		return nil
+	})
+	return info, err
+}
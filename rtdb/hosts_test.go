@@ -0,0 +1,150 @@
+package rtdb
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// go test -timeout 30s -run ^Test_hostPool$ github.com/racetopdb/gortdb/rtdb -v
+func Test_hostPool(t *testing.T) {
+	Convey("Test_hostPool", t, func(ctx C) {
+		now := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+		newPool := func(policy string) *hostPool {
+			p := newHostPool(&Config{Address: "h1:9000, h2:9000,h3:9000", HostPolicy: policy, HostCooldown: time.Minute})
+			p.now = func() time.Time { return now }
+			return p
+		}
+
+		Convey("HostAndPort should return the first host", func(ctx C) {
+			host, port := (&Config{Address: "h1:9001,h2:9000"}).HostAndPort()
+			So(host, ShouldEqual, "h1")
+			So(port, ShouldEqual, 9001)
+
+			// the default address is only used without an address
+			host, port = (&Config{Address: "db1:90a0"}).HostAndPort()
+			So(host, ShouldEqual, "db1:90a0")
+			So(port, ShouldEqual, 0)
+			host, port = (&Config{}).HostAndPort()
+			So(host, ShouldEqual, "127.0.0.1")
+			So(port, ShouldEqual, 9000)
+		})
+
+		Convey("Failover should keep the order of the DSN", func(ctx C) {
+			p := newPool(HostPolicyFailover)
+			So(p.order(), ShouldResemble, []string{"h1:9000", "h2:9000", "h3:9000"})
+			So(p.order(), ShouldResemble, []string{"h1:9000", "h2:9000", "h3:9000"})
+		})
+
+		Convey("Roundrobin should start with the next host", func(ctx C) {
+			p := newPool(HostPolicyRoundRobin)
+			So(p.order(), ShouldResemble, []string{"h1:9000", "h2:9000", "h3:9000"})
+			So(p.order(), ShouldResemble, []string{"h2:9000", "h3:9000", "h1:9000"})
+			So(p.order(), ShouldResemble, []string{"h3:9000", "h1:9000", "h2:9000"})
+		})
+
+		Convey("Random should try every host", func(ctx C) {
+			So(newPool(HostPolicyRandom).order(), ShouldHaveLength, 3)
+		})
+
+		Convey("A host which is down should be tried last until the cooldown ends", func(ctx C) {
+			p := newPool(HostPolicyFailover)
+			p.markDown("h1:9000")
+			So(p.order(), ShouldResemble, []string{"h2:9000", "h3:9000", "h1:9000"})
+			now = now.Add(time.Minute)
+			So(p.order(), ShouldResemble, []string{"h1:9000", "h2:9000", "h3:9000"})
+		})
+	})
+}
+
+// go test -timeout 30s -run ^Test_connector_Connect_hosts$ github.com/racetopdb/gortdb/rtdb -v
+func Test_connector_Connect_hosts(t *testing.T) {
+	Convey("Test_connector_Connect_hosts", t, func(ctx C) {
+		var tried []string
+		factory := func(cfg *Config) (Backend, error) {
+			tried = append(tried, cfg.Address)
+			if cfg.Address == "h1:9000" {
+				return &downBackend{}, nil
+			}
+			return &fakeBackend{results: map[string]fakeResult{pingQuery: {}}}, nil
+		}
+		connector, err := NewDriver(WithBackend(factory)).OpenConnector("test:test@tcp(h1:9000,h2:9000)/?hostPolicy=failover")
+		So(err, ShouldBeNil)
+		db := sql.OpenDB(connector)
+		defer db.Close()
+
+		conn, err := db.Conn(context.Background())
+		So(err, ShouldBeNil)
+		defer conn.Close()
+		So(tried, ShouldResemble, []string{"h1:9000", "h2:9000"})
+		info, err := ConnectionInfo(conn)
+		So(err, ShouldBeNil)
+		So(info.Host, ShouldEqual, "h2:9000")
+
+		// h1 is down, the next connection goes to h2 at once
+		tried = nil
+		conn2, err := db.Conn(context.Background())
+		So(err, ShouldBeNil)
+		defer conn2.Close()
+		So(tried, ShouldResemble, []string{"h2:9000"})
+
+	})
+}
+
+// slowBackend is a backend whose login takes delay.
+type slowBackend struct {
+	fakeBackend
+	delay time.Duration
+}
+
+func (b *slowBackend) Connect() error {
+	time.Sleep(b.delay)
+	return b.fakeBackend.Connect()
+}
+
+// go test -timeout 30s -run ^Test_connector_Connect_failover$ github.com/racetopdb/gortdb/rtdb -v
+func Test_connector_Connect_failover(t *testing.T) {
+	Convey("Test_connector_Connect_failover", t, func(ctx C) {
+		Convey("A host whose backend can not be created should be skipped", func(ctx C) {
+			var tried []string
+			c, err := NewDriver(WithBackend(func(cfg *Config) (Backend, error) {
+				tried = append(tried, cfg.Address)
+				if cfg.Address == "h1:9000" {
+					return nil, TLSUnsupported
+				}
+				return &fakeBackend{results: map[string]fakeResult{pingQuery: {}}}, nil
+			})).OpenConnector("test:test@tcp(h1:9000,h2:9000)/?hostPolicy=failover")
+			So(err, ShouldBeNil)
+			conn, err := c.Connect(context.Background())
+			So(err, ShouldBeNil)
+			defer conn.Close()
+			So(tried, ShouldResemble, []string{"h1:9000", "h2:9000"})
+			// h1 is not known to be down
+			So(c.(*connector).hosts.order(), ShouldResemble, []string{"h1:9000", "h2:9000"})
+		})
+
+		Convey("A host should not be marked down when the context ends", func(ctx C) {
+			c, err := NewDriver(WithBackend(func(cfg *Config) (Backend, error) {
+				return &slowBackend{delay: 100 * time.Millisecond}, nil
+			})).OpenConnector("test:test@tcp(h1:9000,h2:9000)/?hostPolicy=failover")
+			So(err, ShouldBeNil)
+			cxt, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			defer cancel()
+			_, err = c.Connect(cxt)
+			So(err == context.DeadlineExceeded, ShouldBeTrue)
+			So(c.(*connector).hosts.order(), ShouldResemble, []string{"h1:9000", "h2:9000"})
+		})
+	})
+}
+
+// downBackend is a backend whose server can not be reached.
+type downBackend struct {
+	fakeBackend
+}
+
+func (b *downBackend) Connect() error {
+	return newError(opConnect, ECONNREFUSED, "")
+}
@@ -0,0 +1,56 @@
+package rtdb
+
+import (
+	"os"
+	"path/filepath"
+)
+
+const (
+	// libraryName is the file name of the rtdb C connector.
+	libraryName = "libtsdb.so"
+	// libraryPathEnv names the environment variable with the path of libtsdb.so or
+	// of its directory, it is used when the DSN has no libPath.
+	libraryPathEnv = "RTDB_LIB_PATH"
+)
+
+// NativeLibraryInfo describes the libtsdb.so loaded by the driver.
+type NativeLibraryInfo struct {
+	Path             string // path the library has been loaded from
+	BuildVersion     string // build time of the library, e.g. "2021-05-19 07:27:56"
+	InterfaceVersion uint64 // TSDB_ML_VERSION the library has been built with
+	DriverVersion    uint64 // TSDB_ML_VERSION the driver has been built with
+	LowestVersion    uint64 // oldest interface version accepted by the driver
+	TLS              bool   // whether the library has a TLS client, tsdb_tls and tsdb_ml_tls_s, it is not used yet, see TLSUnsupported
+}
+
+// standardLibraryDirs are searched after the paths of the dynamic linker.
+var standardLibraryDirs = []string{
+	"/usr/lib",
+	"/usr/lib64",
+	"/usr/local/lib",
+	"/usr/local/tsdb/lib",
+}
+
+// libraryCandidates returns the paths tried in order to load libtsdb. A path set
+// by the DSN or the environment is the only candidate, then the embedded library.
+// Otherwise the library is searched by the dynamic linker (LD_LIBRARY_PATH,
+// ld.so.cache) and then in the standard locations.
+func libraryCandidates(path string, env string, embedded func() (string, error)) ([]string, error) {
+	for _, p := range []string{path, env} {
+		if p == "" {
+			continue
+		}
+		if info, err := os.Stat(p); err == nil && info.IsDir() {
+			p = filepath.Join(p, libraryName)
+		}
+		return []string{p}, nil
+	}
+	if p, err := embedded(); err != nil || p != "" {
+		return []string{p}, err
+	}
+	candidates := []string{libraryName}
+	for _, dir := range standardLibraryDirs {
+		candidates = append(candidates, filepath.Join(dir, libraryName))
+	}
+	return candidates, nil
+}
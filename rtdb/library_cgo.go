@@ -0,0 +1,142 @@
+//go:build cgo
+// +build cgo
+
+package rtdb
+
+//#cgo linux CFLAGS: -I${SRCDIR}/../include
+//#include "stdlib.h"
+//#include "tsdb_dl.h"
+import "C"
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"unsafe"
+)
+
+// maxLibraryErrLen is the size of the buffer for the reason of a failed dlopen.
+const maxLibraryErrLen = 512
+
+var nativeLibrary struct {
+	mu   sync.Mutex
+	path string // path of the loaded library, empty until it is loaded
+}
+
+// errLibraryVersion is returned by dlopenLibrary when the library is loaded but
+// its interface version is not supported.
+type errLibraryVersion string
+
+func (e errLibraryVersion) Error() string { return string(e) }
+
+// LibraryInfo returns the version of libtsdb, loading it from the standard
+// locations when no connection has been opened yet.
+func LibraryInfo() (NativeLibraryInfo, error) {
+	if err := loadLibrary(""); err != nil {
+		return NativeLibraryInfo{}, err
+	}
+	nativeLibrary.mu.Lock()
+	defer nativeLibrary.mu.Unlock()
+	var build *C.char
+	version := C.gortdb_tsdb_version(&build)
+	return NativeLibraryInfo{
+		Path:             nativeLibrary.path,
+		BuildVersion:     C.GoString(build),
+		InterfaceVersion: uint64(version),
+		DriverVersion:    uint64(C.TSDB_ML_VERSION),
+		LowestVersion:    uint64(C.TSDB_ML_VERSION_LOW),
+		TLS:              C.gortdb_tsdb_tls_supported() != 0,
+	}, nil
+}
+
+// tlsUnsupported returns TLSUnsupported naming the loaded library. A TLS client
+// of the library is not used either, the parameters of its connection string
+// are not documented.
+func tlsUnsupported() error {
+	info, err := LibraryInfo()
+	if err != nil {
+		return TLSUnsupported
+	}
+	reason := "does not export tsdb_tls and tsdb_ml_tls_s"
+	if info.TLS {
+		reason = "exports a TLS client whose connection string parameters are not documented"
+	}
+	return fmt.Errorf("%w: %s (build %s, interface version %d) %s",
+		TLSUnsupported, info.Path, info.BuildVersion, info.InterfaceVersion, reason)
+}
+
+// loadLibrary opens libtsdb once per process. path is the libPath of the DSN, it
+// may be empty. It returns an error wrapping LibraryUnavailable with the reason of
+// every failed candidate, or LibraryIncompatible when a library has been found
+// but none has a supported interface version. A library can not be unloaded, so
+// a path other than the one of the loaded library returns LibraryConflict.
+func loadLibrary(path string) error {
+	nativeLibrary.mu.Lock()
+	defer nativeLibrary.mu.Unlock()
+	if nativeLibrary.path != "" {
+		if path == "" {
+			return nil
+		}
+		candidates, err := libraryCandidates(path, "", embeddedLibrary)
+		if err != nil {
+			return fmt.Errorf("%w: %v", LibraryUnavailable, err)
+		}
+		if !sameLibrary(candidates[0], nativeLibrary.path) {
+			return fmt.Errorf("%w: libPath %s, loaded %s", LibraryConflict, candidates[0], nativeLibrary.path)
+		}
+		return nil
+	}
+	candidates, err := libraryCandidates(path, os.Getenv(libraryPathEnv), embeddedLibrary)
+	if err != nil {
+		return fmt.Errorf("%w: %v", LibraryUnavailable, err)
+	}
+	reasons := make([]string, 0, len(candidates))
+	sentinel := LibraryUnavailable
+	for _, candidate := range candidates {
+		if err := dlopenLibrary(candidate, false); err != nil {
+			if _, ok := err.(errLibraryVersion); ok {
+				sentinel = LibraryIncompatible
+			}
+			reasons = append(reasons, err.Error())
+			continue
+		}
+		nativeLibrary.path = candidate
+		return nil
+	}
+	return fmt.Errorf("%w: %s", sentinel, strings.Join(reasons, "; "))
+}
+
+// dlopenLibrary opens the library at path, resolves its symbols and negotiates
+// the interface version, probe only checks the library and closes it again.
+func dlopenLibrary(path string, probe bool) error {
+	cPath := C.CString(path)
+	defer C.free(unsafe.Pointer(cPath))
+	cErr := (*C.char)(C.calloc(maxLibraryErrLen, 1))
+	defer C.free(unsafe.Pointer(cErr))
+	var ret C.int
+	if probe {
+		ret = C.gortdb_tsdb_probe(cPath, cErr, maxLibraryErrLen)
+	} else {
+		ret = C.gortdb_tsdb_load(cPath, cErr, maxLibraryErrLen)
+	}
+	switch ret {
+	case 0:
+	case C.GORTDB_EVERSION:
+		return errLibraryVersion(C.GoString(cErr))
+	default:
+		return fmt.Errorf("%s", C.GoString(cErr))
+	}
+	return nil
+}
+
+// sameLibrary reports whether the paths a and b name the same file, a name found
+// by the dynamic linker only matches itself.
+func sameLibrary(a, b string) bool {
+	if a == b {
+		return true
+	}
+	infoA, errA := os.Stat(a)
+	infoB, errB := os.Stat(b)
+	return errA == nil && errB == nil && os.SameFile(infoA, infoB)
+}
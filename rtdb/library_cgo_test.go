@@ -0,0 +1,64 @@
+//go:build cgo
+// +build cgo
+
+package rtdb
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// go test -timeout 30s -run ^Test_dlopenLibrary$ github.com/racetopdb/gortdb/rtdb -v
+func Test_dlopenLibrary(t *testing.T) {
+	Convey("Test_dlopenLibrary", t, func(ctx C) {
+		Convey("The library of the repository should resolve all symbols", func(ctx C) {
+			So(dlopenLibrary(filepath.Join("..", "dll", "linux", libraryName), true), ShouldBeNil)
+		})
+
+		Convey("A missing library should report the path", func(ctx C) {
+			err := dlopenLibrary("/nonexistent/libtsdb.so", true)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "/nonexistent/libtsdb.so")
+		})
+
+		Convey("A library without the tsdb symbols should be rejected", func(ctx C) {
+			err := dlopenLibrary("libc.so.6", true)
+			So(err, ShouldBeError, "libc.so.6: undefined symbol tsdb_new")
+		})
+	})
+}
+
+// go test -timeout 30s -run ^TestLibraryInfo$ github.com/racetopdb/gortdb/rtdb -v
+func TestLibraryInfo(t *testing.T) {
+	Convey("TestLibraryInfo", t, func(ctx C) {
+		So(loadLibrary(getEnv(libraryPathEnv, filepath.Join("..", "dll", "linux"))), ShouldBeNil)
+		info, err := LibraryInfo()
+		So(err, ShouldBeNil)
+		So(info.Path, ShouldNotBeEmpty)
+		So(info.BuildVersion, ShouldNotBeEmpty)
+		So(info.DriverVersion, ShouldEqual, uint64(202120031650))
+		So(info.InterfaceVersion, ShouldBeGreaterThanOrEqualTo, info.LowestVersion)
+
+		Convey("Another libPath should be rejected once the library is loaded", func(ctx C) {
+			So(loadLibrary(info.Path), ShouldBeNil)
+			So(loadLibrary(filepath.Dir(info.Path)), ShouldBeNil)
+			err := loadLibrary(filepath.Join(t.TempDir(), libraryName))
+			So(errors.Is(err, LibraryConflict), ShouldBeTrue)
+			So(err.Error(), ShouldContainSubstring, info.Path)
+		})
+	})
+}
+
+// go test -timeout 30s -run ^Test_RtdbAdapter_String$ github.com/racetopdb/gortdb/rtdb -v
+func Test_RtdbAdapter_String(t *testing.T) {
+	Convey("Test_RtdbAdapter_String", t, func(ctx C) {
+		a := newRtdbAdapter("", "127.0.0.1", 9000, "test", "s3cret")
+		defer a.CleanUp()
+		So(a.String(), ShouldEqual, "RtdbAdapter(user=test;passwd=xxxxx;servers=tcp://127.0.0.1:9000)")
+		So(fmt.Sprintf("%v %+v %#v", a, a, a), ShouldNotContainSubstring, "s3cret")
+	})
+}
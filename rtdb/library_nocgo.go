@@ -0,0 +1,9 @@
+//go:build !cgo
+// +build !cgo
+
+package rtdb
+
+// LibraryInfo returns ErrNativeUnavailable, libtsdb is never loaded without cgo.
+func LibraryInfo() (NativeLibraryInfo, error) {
+	return NativeLibraryInfo{}, ErrNativeUnavailable
+}
@@ -0,0 +1,42 @@
+package rtdb
+
+import (
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// go test -timeout 30s -run ^Test_libraryCandidates$ github.com/racetopdb/gortdb/rtdb -v
+func Test_libraryCandidates(t *testing.T) {
+	Convey("Test_libraryCandidates", t, func(ctx C) {
+		Convey("The libPath of the DSN should be the only candidate", func(ctx C) {
+			candidates, err := libraryCandidates("/opt/tsdb/libtsdb.so", "/env/libtsdb.so", embeddedLibrary)
+			So(err, ShouldBeNil)
+			So(candidates, ShouldResemble, []string{"/opt/tsdb/libtsdb.so"})
+		})
+
+		Convey("A directory should be completed with the library name", func(ctx C) {
+			candidates, err := libraryCandidates("", filepath.Join("..", "dll", "linux"), embeddedLibrary)
+			So(err, ShouldBeNil)
+			So(candidates, ShouldResemble, []string{filepath.Join("..", "dll", "linux", libraryName)})
+		})
+
+		Convey("Without a path the library should be searched", func(ctx C) {
+			candidates, err := libraryCandidates("", "", noEmbeddedLibrary)
+			So(err, ShouldBeNil)
+			So(candidates[0], ShouldEqual, libraryName)
+			So(candidates, ShouldContain, "/usr/local/tsdb/lib/libtsdb.so")
+		})
+
+		Convey("The embedded library should be preferred to the search", func(ctx C) {
+			candidates, err := libraryCandidates("", "", func() (string, error) { return "/cache/libtsdb.so", nil })
+			So(err, ShouldBeNil)
+			So(candidates, ShouldResemble, []string{"/cache/libtsdb.so"})
+		})
+	})
+}
+
+func noEmbeddedLibrary() (string, error) {
+	return "", nil
+}
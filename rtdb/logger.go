@@ -1,6 +1,7 @@
 package rtdb
 
 import (
+	"fmt"
 	"log"
 	"os"
 )
@@ -8,3 +9,39 @@ import (
 var (
 	rtdbLogger = log.New(os.Stdout, "[rtdb] ", log.Ldate|log.Lshortfile|log.Ltime|log.Ldate)
 )
+
+// Logger is the logger of the connections set with WithLogger, *log.Logger
+// implements it.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// WithLogger makes the connections log to logger instead of the driver logger.
+func WithLogger(logger Logger) Option {
+	return func(c *connector) {
+		c.logger = logger
+	}
+}
+
+// logf logs to the logger of the connection, to the driver logger when it has
+// none. Passwords are redacted from the message.
+func (rc *rtdbConn) logf(format string, v ...interface{}) {
+	msg := redactSecrets(fmt.Sprintf(format, v...))
+	if rc != nil && rc.logger != nil {
+		rc.logger.Printf("%s", msg)
+		return
+	}
+	// report the caller of logf
+	rtdbLogger.Output(2, msg)
+}
+
+// logf logs to the logger of the connector, to the driver logger when it has
+// none. Passwords are redacted from the message.
+func (c *connector) logf(format string, v ...interface{}) {
+	msg := redactSecrets(fmt.Sprintf(format, v...))
+	if c.logger != nil {
+		c.logger.Printf("%s", msg)
+		return
+	}
+	rtdbLogger.Output(2, msg)
+}
@@ -0,0 +1,13 @@
+//go:build windows || plan9
+// +build windows plan9
+
+package rtdb
+
+import "os"
+
+const openNoFollow = 0
+
+// fileOwner is not supported on this platform, the embedded library is not either.
+func fileOwner(info os.FileInfo) (int, bool) {
+	return 0, false
+}
@@ -0,0 +1,21 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package rtdb
+
+import (
+	"os"
+	"syscall"
+)
+
+// openNoFollow makes os.OpenFile fail on a symbolic link.
+const openNoFollow = syscall.O_NOFOLLOW
+
+// fileOwner returns the user id of the owner of the file described by info.
+func fileOwner(info os.FileInfo) (int, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return int(st.Uid), true
+}
@@ -4,29 +4,38 @@ import (
 	"database/sql/driver"
 	"io"
 	"reflect"
+	"time"
 )
 
 type rtdbResult struct {
 	insertId     int64
 	affectedRows int64
+	buffered     bool // the statement is buffered by a transaction
 }
 
 // LastInsertId returns the database's auto-generated ID
 // after, for example, an INSERT into a table with primary
 // key.When execute a SELECT, return zero and nil.
 func (r *rtdbResult) LastInsertId() (int64, error) {
+	if r.buffered {
+		return 0, TxResultUnknown
+	}
 	return r.insertId, nil
 }
 
 // RowsAffected returns the number of rows affected by the
 // query.
 func (r *rtdbResult) RowsAffected() (int64, error) {
+	if r.buffered {
+		return 0, TxResultUnknown
+	}
 	return r.affectedRows, nil
 }
 
 type rtdbRows struct {
 	rc        *rtdbConn
 	resultSet rtdbResultSet
+	stream    *rowStream // set when the rows are read in chunks
 }
 
 func (r *rtdbRows) Columns() []string {
@@ -36,14 +45,21 @@ func (r *rtdbRows) Columns() []string {
 
 	columns := make([]string, len(r.resultSet.columns))
 	for i := range columns {
-		columns[i] = r.resultSet.columns[i].name
+		columns[i] = r.resultSet.columns[i].Name
 	}
 	r.resultSet.columnNames = columns
 	return columns
 }
 
+// Close frees the native result set, the rows can not be read any more.
 func (r *rtdbRows) Close() error {
-	return nil
+	rc := r.rc
+	if rc == nil {
+		return nil
+	}
+	r.rc = nil
+	r.stream = nil
+	return rc.freeResult()
 }
 
 func (r *rtdbRows) Next(dest []driver.Value) error {
@@ -68,25 +84,48 @@ func (r *rtdbRows) NextResultSet() error {
 // fetchOne fetch one row from rtdb connection.
 func (r *rtdbRows) fetchOne(dest []driver.Value) error {
 	rc := r.rc
-	if r.readDone() {
+	if rc == nil {
 		return io.EOF
 	}
-	values, err := rc.FetchOne()
+	if r.readDone() {
+		if r.stream == nil {
+			return io.EOF
+		}
+		more, err := r.nextChunk()
+		if err != nil {
+			return err
+		}
+		if !more {
+			return io.EOF
+		}
+	}
+	values, err := rc.backend.FetchOne()
 	if err != nil {
-		return err
+		return rc.decodeError("", err)
 	}
 	if len(values) != len(dest) {
 		return driver.ErrSkip
 	}
 	for i := range dest {
+		if t, ok := values[i].(time.Time); ok && r.resultSet.columns[i].Type == FieldTypeDatetime {
+			dest[i] = rc.convertTime(t)
+			continue
+		}
+		if s, ok := values[i].(string); ok && r.resultSet.columns[i].Type == FieldTypeString {
+			dest[i] = rc.decodeString(s)
+			continue
+		}
 		dest[i] = driver.Value(values[i])
 	}
+	if r.stream != nil {
+		r.stream.progress.Rows++
+	}
 	return nil
 
 }
 
 func (r *rtdbRows) readDone() bool {
-	return r.rc.readDone()
+	return r.rc == nil || r.rc.backend.ReadDone()
 }
 
 func (r *rtdbRows) ColumnTypeDatabaseTypeName(i int) string {
@@ -94,14 +133,25 @@ func (r *rtdbRows) ColumnTypeDatabaseTypeName(i int) string {
 }
 
 func (r *rtdbRows) ColumnTypeScanType(i int) reflect.Type {
+	if column := r.resultSet.columns[i]; column.Type == FieldTypeDatetime && r.rc != nil && !r.rc.parseTime() {
+		if column.Nullable {
+			return scanTypeNullInt
+		}
+		return scanTypeInt64
+	}
 	return r.resultSet.columns[i].scanType()
 }
 
+// ColumnTypeNullable reports the is_null flag of the field.
+func (r *rtdbRows) ColumnTypeNullable(i int) (nullable, ok bool) {
+	return r.resultSet.columns[i].Nullable, true
+}
+
 func (r *rtdbRows) ColumnTypePrecisionScale(i int) (int64, int64, bool) {
 	return -1, -1, false
 }
 
 type rtdbResultSet struct {
-	columns     []rtdbField
+	columns     []Field
 	columnNames []string
 }
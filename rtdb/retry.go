@@ -0,0 +1,152 @@
+package rtdb
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+const (
+	defaultRetryBackoff    = 100 * time.Millisecond
+	defaultRetryMaxBackoff = 2 * time.Second
+)
+
+// Attempt describes one execution of a statement on the server, see Hooks.
+type Attempt struct {
+	Query   string        // statement sent to the server
+	N       int           // number of the attempt, starting at 1
+	Err     error         // error of the attempt, nil before it is sent
+	Elapsed time.Duration // duration of the attempt, zero before it is sent
+	Retry   bool          // whether the statement is sent again after this attempt
+}
+
+// Hooks are called around every attempt of the statements sent by a connection,
+// including the statement of Ping. A pooled connection is not pinged before it is
+// reused, see ResetSession. They run on the goroutine of the native call and must
+// not block.
+type Hooks struct {
+	BeforeAttempt func(a Attempt) // called before the statement is sent
+	AfterAttempt  func(a Attempt) // called with the outcome of the attempt
+}
+
+// WithHooks makes the connections call hooks around every attempt.
+func WithHooks(hooks Hooks) Option {
+	return func(c *connector) {
+		c.hooks = hooks
+	}
+}
+
+// retryable reports whether err is transient: a busy or interrupted call, or a
+// broken connection which is opened again before the next attempt.
+func retryable(err error) bool {
+	var rerr *Error
+	return errors.As(err, &rerr) && (rerr.Temporary() || rerr.Network())
+}
+
+// retryDelay returns the backoff before the attempt following attempt n, it is
+// doubled after every attempt up to Config.RetryMaxBackoff.
+func (c *Config) retryDelay(n int) time.Duration {
+	delay, max := c.RetryBackoff, c.RetryMaxBackoff
+	if delay <= 0 {
+		delay = defaultRetryBackoff
+	}
+	if max <= 0 {
+		max = defaultRetryMaxBackoff
+	}
+	for i := 1; i < n && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+	return delay
+}
+
+// send sends query and stores its result. A read statement failing with a
+// transient error is sent again up to Config.Retries times, statements which
+// change data are never repeated since the server may have applied them.
+// query is converted to Config.Charset before it is sent. No attempt is sent
+// after ctx is done or the connection has been marked bad, e.g. quarantined by
+// withContext when the caller gave up.
+func (rc *rtdbConn) send(ctx context.Context, query string) error {
+	encoded, err := rc.encodeSQL(query)
+	if err != nil {
+		return err
+	}
+	retries := 0
+	if rc.config != nil && isReadStatement(query) {
+		retries = rc.config.Retries
+	}
+	var reconnect bool
+	for n := 1; ; n++ {
+		a := Attempt{Query: query, N: n}
+		if rc.hooks.BeforeAttempt != nil {
+			rc.hooks.BeforeAttempt(a)
+		}
+		start := time.Now()
+		err := rc.sendOnce(encoded, reconnect)
+		a.Err, a.Elapsed = err, time.Since(start)
+		a.Retry = err != nil && n <= retries && retryable(err) && !rc.closed.IsSet() && ctx.Err() == nil
+		if rc.hooks.AfterAttempt != nil {
+			rc.hooks.AfterAttempt(a)
+		}
+		if !a.Retry {
+			return rc.sendError(query, err)
+		}
+		delay := rc.config.retryDelay(n)
+		rc.logf("attempt %d of %s failed, retrying in %v, err: %v", n, redactSQL(query), delay, err)
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return rc.decodeError(query, err)
+		case <-rc.closech:
+			timer.Stop()
+			return rc.decodeError(query, err)
+		}
+		if rc.closed.IsSet() {
+			return rc.decodeError(query, err)
+		}
+		var rerr *Error
+		reconnect = errors.As(err, &rerr) && rerr.Network()
+	}
+}
+
+// sendError returns the error of the last attempt of query, decoded from
+// Config.Charset, see decodeError. A statement which
+// changes data may have been applied when the connection broke, its error does
+// not report driver.ErrBadConn, so database/sql does not run it again, and the
+// connection is marked bad instead.
+func (rc *rtdbConn) sendError(query string, err error) error {
+	var rerr *Error
+	if errors.As(err, &rerr) && rerr.Network() && rerr.Op == opQuery && !isReadStatement(query) {
+		rerr.mayBeApplied = true
+		rc.markBad()
+	}
+	return rc.decodeError(query, err)
+}
+
+// sendOnce sends query once, after logging in again when reconnect is set.
+func (rc *rtdbConn) sendOnce(query string, reconnect bool) error {
+	if reconnect {
+		if err := rc.reconnect(); err != nil {
+			return err
+		}
+	}
+	if err := rc.backend.Query(query, rc.config.Charset, rc.config.DBName); err != nil {
+		return err
+	}
+	return rc.backend.StoreResult()
+}
+
+// reconnect logs in again after a broken connection, see Reconnector.
+func (rc *rtdbConn) reconnect() error {
+	if r, ok := rc.backend.(Reconnector); ok {
+		return r.Reconnect()
+	}
+	if err := rc.backend.Disconnect(); err != nil {
+		rc.logf("disconnect before retry failed, err: %v", err)
+	}
+	return rc.backend.Connect()
+}
@@ -0,0 +1,187 @@
+package rtdb
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// flakyBackend fails the first statements with err before answering from the script.
+type flakyBackend struct {
+	fakeBackend
+	failures int
+	err      error
+	connects int
+}
+
+func (b *flakyBackend) Connect() error {
+	b.connects++
+	return b.fakeBackend.Connect()
+}
+
+func (b *flakyBackend) Query(sql string, charset string, db string) error {
+	if b.failures > 0 {
+		b.failures--
+		b.queries = append(b.queries, sql)
+		return b.err
+	}
+	return b.fakeBackend.Query(sql, charset, db)
+}
+
+// reconnectBackend logs in again without disconnecting.
+type reconnectBackend struct {
+	flakyBackend
+	reconnects  int
+	disconnects int
+}
+
+func (b *reconnectBackend) Reconnect() error {
+	b.reconnects++
+	return nil
+}
+
+func (b *reconnectBackend) Disconnect() error {
+	b.disconnects++
+	return b.flakyBackend.Disconnect()
+}
+
+// go test -timeout 30s -run ^Test_rtdbConn_send$ github.com/racetopdb/gortdb/rtdb -v
+func Test_rtdbConn_send(t *testing.T) {
+	Convey("Test_rtdbConn_send", t, func(ctx C) {
+		backend := &flakyBackend{fakeBackend: fakeBackend{results: map[string]fakeResult{
+			pingQuery:                     {},
+			"select * from t":             {fields: []Field{{Name: "id", Type: FieldTypeInt}}, rows: [][]interface{}{{int32(1)}}},
+			"insert into t(id) values(1)": {},
+		}}}
+		var attempts []Attempt
+		open := func(dsn string) *sql.DB {
+			connector, err := NewDriver(
+				WithBackend(func(cfg *Config) (Backend, error) { return backend, nil }),
+				WithHooks(Hooks{AfterAttempt: func(a Attempt) { attempts = append(attempts, a) }}),
+			).OpenConnector(dsn)
+			So(err, ShouldBeNil)
+			return sql.OpenDB(connector)
+		}
+
+		Convey("A read statement should be retried after transient errors", func(ctx C) {
+			db := open("test:test@tcp(127.0.0.1:9000)/?retries=3&retryBackoff=1ms")
+			defer db.Close()
+			backend.failures, backend.err = 2, newError(opQuery, EAGAIN, "")
+			var id int
+			So(db.QueryRow("select * from t").Scan(&id), ShouldBeNil)
+			So(id, ShouldEqual, 1)
+			So(len(attempts), ShouldEqual, 3)
+			So(attempts[0].N, ShouldEqual, 1)
+			So(attempts[0].Retry, ShouldBeTrue)
+			So(attempts[2].Err, ShouldBeNil)
+			So(attempts[2].Retry, ShouldBeFalse)
+			So(backend.connects, ShouldEqual, 1)
+		})
+
+		Convey("A broken connection should be opened again before the retry", func(ctx C) {
+			db := open("test:test@tcp(127.0.0.1:9000)/?retries=1&retryBackoff=1ms")
+			defer db.Close()
+			backend.failures, backend.err = 1, newError(opQuery, EPIPE, "")
+			rows, err := db.Query("select * from t")
+			So(err, ShouldBeNil)
+			So(rows.Close(), ShouldBeNil)
+			So(backend.connects, ShouldEqual, 2)
+		})
+
+		Convey("A broken write should not be reported as driver.ErrBadConn", func(ctx C) {
+			db := open("test:test@tcp(127.0.0.1:9000)/?retries=3&retryBackoff=1ms")
+			defer db.Close()
+			backend.failures, backend.err = 3, newError(opQuery, EPIPE, "")
+			_, err := db.Exec("insert into t(id) values(1)")
+			So(err, ShouldBeError, backend.err)
+			So(errors.Is(err, driver.ErrBadConn), ShouldBeFalse)
+			// database/sql runs a call failing with driver.ErrBadConn again
+			So(backend.queries, ShouldResemble, []string{"insert into t(id) values(1)"})
+			So(errors.Is(newError(opQuery, EPIPE, ""), driver.ErrBadConn), ShouldBeTrue)
+		})
+
+		Convey("Retries should stop after Config.Retries", func(ctx C) {
+			db := open("test:test@tcp(127.0.0.1:9000)/?retries=1&retryBackoff=1ms")
+			defer db.Close()
+			backend.failures, backend.err = 5, newError(opQuery, EBUSY, "")
+			_, err := db.QueryContext(context.Background(), "select * from t")
+			So(err, ShouldBeError, backend.err)
+			So(len(attempts), ShouldEqual, 2)
+		})
+
+		Convey("Statements which change data should never be repeated", func(ctx C) {
+			db := open("test:test@tcp(127.0.0.1:9000)/?retries=3&retryBackoff=1ms")
+			defer db.Close()
+			backend.failures, backend.err = 1, newError(opQuery, EAGAIN, "")
+			_, err := db.Exec("insert into t(id) values(1)")
+			So(err, ShouldBeError, backend.err)
+			So(len(attempts), ShouldEqual, 1)
+		})
+
+		Convey("Errors which are not transient should not be retried", func(ctx C) {
+			db := open("test:test@tcp(127.0.0.1:9000)/?retries=3&retryBackoff=1ms")
+			defer db.Close()
+			backend.failures, backend.err = 1, newError(opQuery, EINVAL, "")
+			_, err := db.Query("select * from t")
+			So(err, ShouldBeError, backend.err)
+			So(len(attempts), ShouldEqual, 1)
+		})
+
+		Convey("No attempt should be sent after the caller gave up", func(ctx C) {
+			var sent int32
+			connector, err := NewDriver(
+				WithBackend(func(cfg *Config) (Backend, error) { return backend, nil }),
+				WithHooks(Hooks{BeforeAttempt: func(a Attempt) { atomic.AddInt32(&sent, 1) }}),
+			).OpenConnector("test:test@tcp(127.0.0.1:9000)/?retries=3&retryBackoff=100ms")
+			So(err, ShouldBeNil)
+			db := sql.OpenDB(connector)
+			defer db.Close()
+			So(db.Ping(), ShouldBeNil)
+			atomic.StoreInt32(&sent, 0)
+			backend.failures, backend.err = 5, newError(opQuery, EAGAIN, "")
+			cxt, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+			defer cancel()
+			_, err = db.QueryContext(cxt, "select * from t")
+			So(err == context.DeadlineExceeded, ShouldBeTrue)
+			time.Sleep(150 * time.Millisecond)
+			So(atomic.LoadInt32(&sent), ShouldEqual, 1)
+		})
+
+		Convey("A Reconnector should log in again without disconnecting", func(ctx C) {
+			backend := &reconnectBackend{flakyBackend: flakyBackend{fakeBackend: backend.fakeBackend}}
+			connector, err := NewDriver(
+				WithBackend(func(cfg *Config) (Backend, error) { return backend, nil }),
+			).OpenConnector("test:test@tcp(127.0.0.1:9000)/?retries=1&retryBackoff=1ms")
+			So(err, ShouldBeNil)
+			db := sql.OpenDB(connector)
+			defer db.Close()
+			backend.failures, backend.err = 1, newError(opQuery, EPIPE, "")
+			rows, err := db.Query("select * from t")
+			So(err, ShouldBeNil)
+			So(rows.Close(), ShouldBeNil)
+			So(backend.reconnects, ShouldEqual, 1)
+			So(backend.disconnects, ShouldEqual, 0)
+			So(backend.connects, ShouldEqual, 1)
+		})
+	})
+}
+
+// go test -timeout 30s -run ^TestConfig_retryDelay$ github.com/racetopdb/gortdb/rtdb -v
+func TestConfig_retryDelay(t *testing.T) {
+	Convey("TestConfig_retryDelay", t, func(ctx C) {
+		config := &Config{RetryBackoff: 100 * time.Millisecond, RetryMaxBackoff: time.Second}
+		So(config.retryDelay(1), ShouldEqual, 100*time.Millisecond)
+		So(config.retryDelay(2), ShouldEqual, 200*time.Millisecond)
+		So(config.retryDelay(4), ShouldEqual, 800*time.Millisecond)
+		So(config.retryDelay(5), ShouldEqual, time.Second)
+		So(config.retryDelay(100), ShouldEqual, time.Second)
+		So((&Config{}).retryDelay(1), ShouldEqual, defaultRetryBackoff)
+
+	})
+}
@@ -0,0 +1,243 @@
+package rtdb
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+)
+
+// sessionManager serializes the process wide login of libtsdb.
+//
+// tsdb_connect/tsdb_disconnect/tsdb_is_logined do not take a client handle (neither
+// does the tsdb_ml_t vtable), so every client of the process shares one hidden
+// login. The manager keeps track of the connection string the login is bound to
+// and of the open connections of every connection string, which are identified
+// by sessionKey so that the password is not used as a key:
+//   - a session is acquired for the query and store of a result set, stored
+//     result sets do not need the login, sessions of the bound connection
+//     string run concurrently,
+//   - a session of another connection string waits until the sessions of the
+//     bound one are released, then re-binds the login,
+//   - the login is only dropped when the last connection of its connection string
+//     is closed, or when the last session of it is released after that.
+//
+// The native connect and disconnect run without holding sm.mu, the calls which
+// need the login wait for them, closing a connection never waits, so it may be
+// called from a finalizer.
+type sessionManager struct {
+	mu         sync.Mutex
+	cond       *sync.Cond
+	bound      string                 // key of the current login, "" when logged out.
+	active     int                    // acquired sessions of the bound connection string.
+	binding    bool                   // a native connect or disconnect is running.
+	logins     map[string]*loginState // registered connection strings by key.
+	connect    func(connStr string) error
+	disconnect func() error
+}
+
+// loginState is a registered connection string, it is kept while connections of
+// it are open, the login may be re-bound to it.
+type loginState struct {
+	connStr string
+	refs    int // open connections
+}
+
+// sessionKey identifies the login of connStr in the sessionManager.
+func sessionKey(connStr string) string {
+	sum := sha256.Sum256([]byte(connStr))
+	return hex.EncodeToString(sum[:])
+}
+
+func newSessionManager(connect func(connStr string) error, disconnect func() error) *sessionManager {
+	sm := &sessionManager{
+		logins:     make(map[string]*loginState),
+		connect:    connect,
+		disconnect: disconnect,
+	}
+	sm.cond = sync.NewCond(&sm.mu)
+	return sm
+}
+
+// rebind binds the login to the connection string of key once the sessions of
+// the bound connection string are released, the caller must hold sm.mu.
+func (sm *sessionManager) rebind(key string, connStr string) error {
+	for sm.binding || sm.bound != key && sm.active > 0 {
+		sm.cond.Wait()
+	}
+	if sm.bound == key {
+		return nil
+	}
+	if sm.bound != "" {
+		if err := sm.drop(); err != nil {
+			rtdbLogger.Printf("disconnect the current session failed, err: %v", err)
+		}
+	}
+	return sm.bind(key, connStr)
+}
+
+// bind logs in with connStr, the login must have been dropped. The login is
+// dropped again when the last connection of key has been closed during the
+// connect. The caller must hold sm.mu.
+func (sm *sessionManager) bind(key string, connStr string) error {
+	if err := sm.unlocked(func() error { return sm.connect(connStr) }); err != nil {
+		return err
+	}
+	sm.bound = key
+	if _, ok := sm.logins[key]; !ok {
+		if err := sm.drop(); err != nil {
+			rtdbLogger.Printf("disconnect the closed session failed, err: %v", err)
+		}
+		return InvalidConn
+	}
+	return nil
+}
+
+// drop logs out, the caller must hold sm.mu.
+func (sm *sessionManager) drop() error {
+	sm.bound = ""
+	return sm.unlocked(sm.disconnect)
+}
+
+// unlocked runs a native call of the login without holding sm.mu, so that a
+// hanging connect does not block the calls which do not need the login, rebind
+// waits for it. The caller must hold sm.mu.
+func (sm *sessionManager) unlocked(call func() error) error {
+	sm.binding = true
+	sm.mu.Unlock()
+	defer func() {
+		sm.mu.Lock()
+		sm.binding = false
+		sm.cond.Broadcast()
+	}()
+	return call()
+}
+
+// registered returns the connection string of key for rebind, InvalidConn when
+// no connection of it is open. The caller must hold sm.mu.
+func (sm *sessionManager) registered(key string) (string, error) {
+	login, ok := sm.logins[key]
+	if !ok {
+		return "", InvalidConn
+	}
+	return login.connStr, nil
+}
+
+// unregister removes a connection of key, it reports whether it was the last
+// one. The caller must hold sm.mu.
+func (sm *sessionManager) unregister(key string) bool {
+	login, ok := sm.logins[key]
+	if ok && login.refs > 1 {
+		login.refs--
+		return false
+	}
+	delete(sm.logins, key)
+	return true
+}
+
+// open registers a new connection of connStr and logs in with it, the returned
+// key identifies the connection string in the other calls.
+func (sm *sessionManager) open(connStr string) (string, error) {
+	key := sessionKey(connStr)
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	// registered first, so that the login is kept when the connection string is
+	// closed by another connection during the connect
+	login, ok := sm.logins[key]
+	if !ok {
+		login = &loginState{connStr: connStr}
+		sm.logins[key] = login
+	}
+	login.refs++
+	if err := sm.rebind(key, connStr); err != nil {
+		sm.unregister(key)
+		return "", err
+	}
+	return key, nil
+}
+
+// close unregisters a connection of key without waiting, the login is dropped
+// together with the last connection using it, or by the release of the last
+// session when sessions of it are still acquired.
+func (sm *sessionManager) close(key string) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	if !sm.unregister(key) || sm.bound != key || sm.active > 0 {
+		return nil
+	}
+	return sm.drop()
+}
+
+// relogin logs in with the connection string of key again when its login is not
+// alive, the connection stays registered, so the login is not released for the
+// other connections of it. Their stored result sets do not need the login and are
+// kept.
+func (sm *sessionManager) relogin(key string, isLogined func() bool) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	connStr, err := sm.registered(key)
+	if err != nil {
+		return err
+	}
+	if err := sm.rebind(key, connStr); err != nil {
+		return err
+	}
+	if isLogined() {
+		return nil
+	}
+	if err := sm.drop(); err != nil {
+		rtdbLogger.Printf("disconnect the broken session failed, err: %v", err)
+	}
+	return sm.bind(key, connStr)
+}
+
+// acquire binds the login to the connection string of key and holds it until
+// the returned release function is called.
+func (sm *sessionManager) acquire(key string) (release func(), err error) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	connStr, err := sm.registered(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := sm.rebind(key, connStr); err != nil {
+		return nil, err
+	}
+	sm.active++
+	var once sync.Once
+	return func() {
+		once.Do(sm.release)
+	}, nil
+}
+
+// release releases a session, the login is dropped with the last session when
+// its connection string has been closed in the meantime.
+func (sm *sessionManager) release() {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.active--
+	if sm.active > 0 {
+		return
+	}
+	sm.cond.Broadcast()
+	if _, ok := sm.logins[sm.bound]; ok || sm.bound == "" || sm.binding {
+		return
+	}
+	if err := sm.drop(); err != nil {
+		rtdbLogger.Printf("disconnect the closed session failed, err: %v", err)
+	}
+}
+
+// logined reports whether the login of key is alive. A connection string which
+// is not bound is bound first, a closed one is never logined.
+func (sm *sessionManager) logined(key string, isLogined func() bool) bool {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	connStr, err := sm.registered(key)
+	if err != nil {
+		return false
+	}
+	if err := sm.rebind(key, connStr); err != nil {
+		return false
+	}
+	return isLogined()
+}
@@ -0,0 +1,222 @@
+package rtdb
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type fakeLogin struct {
+	mu          sync.Mutex
+	current     string
+	connects    int
+	disconnects int
+	connecting  chan struct{} // signaled when a connect starts, when set
+	hang        chan struct{} // connects wait until it is closed, when set
+}
+
+func (f *fakeLogin) connect(connStr string) error {
+	if f.hang != nil {
+		f.connecting <- struct{}{}
+		<-f.hang
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.current != "" {
+		panic("connect while logined")
+	}
+	f.current = connStr
+	f.connects++
+	return nil
+}
+
+func (f *fakeLogin) disconnect() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.current = ""
+	f.disconnects++
+	return nil
+}
+
+func (f *fakeLogin) login() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.current
+}
+
+// go test -timeout 30s -run ^Test_sessionManager$ github.com/racetopdb/gortdb/rtdb -v
+func Test_sessionManager(t *testing.T) {
+	Convey("Test_sessionManager", t, func(ctx C) {
+		login := &fakeLogin{}
+		sm := newSessionManager(login.connect, login.disconnect)
+		dsn1 := "user=a;passwd=a;servers=tcp://h1:9000"
+		dsn2 := "user=b;passwd=b;servers=tcp://h2:9000"
+		k1, k2 := sessionKey(dsn1), sessionKey(dsn2)
+		// open registers a connection and returns its key
+		open := func(dsn string) string {
+			key, err := sm.open(dsn)
+			if err != nil {
+				return err.Error()
+			}
+			return key
+		}
+
+		Convey("Closing one connection should not disconnect the others", func(ctx C) {
+			So(open(dsn1), ShouldEqual, k1)
+			So(open(dsn1), ShouldEqual, k1)
+			So(login.connects, ShouldEqual, 1)
+			So(sm.close(k1), ShouldBeNil)
+			So(login.disconnects, ShouldEqual, 0)
+			So(login.login(), ShouldEqual, dsn1)
+			// the password is not used as a key
+			So(sm.bound, ShouldEqual, k1)
+			So(k1, ShouldNotContainSubstring, "passwd")
+			So(sm.close(k1), ShouldBeNil)
+			So(login.disconnects, ShouldEqual, 1)
+			So(login.login(), ShouldBeBlank)
+		})
+
+		Convey("Calls for another connection string should re-bind the login", func(ctx C) {
+			So(open(dsn1), ShouldEqual, k1)
+			So(open(dsn2), ShouldEqual, k2)
+			So(login.login(), ShouldEqual, dsn2)
+
+			release, err := sm.acquire(k1)
+			So(err, ShouldBeNil)
+			So(login.login(), ShouldEqual, dsn1)
+			release()
+
+			// dsn2 is not bound, it is bound before its login is checked
+			So(sm.logined(k2, func() bool { return login.login() == dsn2 }), ShouldBeTrue)
+			So(login.login(), ShouldEqual, dsn2)
+			So(sm.close(k2), ShouldBeNil)
+			So(login.login(), ShouldBeBlank)
+			So(sm.logined(k2, func() bool { return true }), ShouldBeFalse)
+		})
+
+		Convey("Logging in again should keep the connections registered", func(ctx C) {
+			So(open(dsn1), ShouldEqual, k1)
+			So(open(dsn1), ShouldEqual, k1)
+			So(sm.relogin(k1, func() bool { return true }), ShouldBeNil)
+			So(login.connects, ShouldEqual, 1)
+
+			So(sm.relogin(k1, func() bool { return false }), ShouldBeNil)
+			So(login.connects, ShouldEqual, 2)
+			So(login.disconnects, ShouldEqual, 1)
+			So(login.login(), ShouldEqual, dsn1)
+			So(sm.close(k1), ShouldBeNil)
+			So(login.login(), ShouldEqual, dsn1)
+			So(sm.close(k1), ShouldBeNil)
+			So(login.login(), ShouldBeBlank)
+			So(sm.relogin(k1, func() bool { return true }), ShouldEqual, InvalidConn)
+		})
+
+		Convey("A session should keep the login bound until it is released", func(ctx C) {
+			So(open(dsn1), ShouldEqual, k1)
+			So(open(dsn2), ShouldEqual, k2)
+			release, err := sm.acquire(k1)
+			So(err, ShouldBeNil)
+			// sessions of the bound connection string do not wait
+			again, err := sm.acquire(k1)
+			So(err, ShouldBeNil)
+			again()
+
+			bound := make(chan string)
+			go func() {
+				release, err := sm.acquire(k2)
+				if err != nil {
+					panic(err)
+				}
+				bound <- login.login()
+				release()
+			}()
+			select {
+			case <-bound:
+				t.Error("the login was re-bound while a session was held")
+			case <-time.After(20 * time.Millisecond):
+			}
+			So(login.login(), ShouldEqual, dsn1)
+			release()
+			release()
+			So(<-bound, ShouldEqual, dsn2)
+		})
+
+		Convey("Closing a connection should not wait for its sessions", func(ctx C) {
+			So(open(dsn1), ShouldEqual, k1)
+			release, err := sm.acquire(k1)
+			So(err, ShouldBeNil)
+			So(sm.close(k1), ShouldBeNil)
+			// the login is dropped by the release of the last session
+			So(login.login(), ShouldEqual, dsn1)
+			release()
+			So(login.disconnects, ShouldEqual, 1)
+			So(login.login(), ShouldBeBlank)
+			_, err = sm.acquire(k1)
+			So(err, ShouldEqual, InvalidConn)
+		})
+
+		Convey("A hanging connect should not block closing other connections", func(ctx C) {
+			So(open(dsn1), ShouldEqual, k1)
+			So(open(dsn1), ShouldEqual, k1)
+			login.connecting, login.hang = make(chan struct{}), make(chan struct{})
+			opened := make(chan string)
+			go func() {
+				opened <- open(dsn2)
+			}()
+			<-login.connecting
+
+			closed := make(chan error)
+			go func() {
+				closed <- sm.close(k1)
+			}()
+			select {
+			case err := <-closed:
+				So(err, ShouldBeNil)
+			case <-time.After(time.Second):
+				t.Error("close waited for the connect of another connection string")
+			}
+			close(login.hang)
+			So(<-opened, ShouldEqual, k2)
+			So(login.login(), ShouldEqual, dsn2)
+			So(sm.close(k1), ShouldBeNil)
+			So(sm.close(k2), ShouldBeNil)
+			So(login.login(), ShouldBeBlank)
+		})
+
+		Convey("Concurrent calls should always run on their own login", func(ctx C) {
+			So(open(dsn1), ShouldEqual, k1)
+			So(open(dsn2), ShouldEqual, k2)
+			var (
+				wg    sync.WaitGroup
+				mu    sync.Mutex
+				wrong int
+			)
+			for i := 0; i < 8; i++ {
+				dsn := dsn1
+				if i%2 == 0 {
+					dsn = dsn2
+				}
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for j := 0; j < 100; j++ {
+						release, err := sm.acquire(sessionKey(dsn))
+						if err != nil {
+							panic(err)
+						}
+						if login.login() != dsn {
+							mu.Lock()
+							wrong++
+							mu.Unlock()
+						}
+						release()
+					}
+				}()
+			}
+			wg.Wait()
+			So(wrong, ShouldEqual, 0)
+		})
+	})
+}
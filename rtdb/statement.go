@@ -1,22 +1,263 @@
 // Go Rtdb Driver - A Rtdb-Driver for Go's database/sql pacakge.
 package rtdb
 
-import "database/sql/driver"
+import (
+	"container/list"
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
 
-type rtdbStmt struct{}
+const (
+	// maxCachedTemplates bounds the number of parsed query templates kept in memory.
+	maxCachedTemplates = 512
+)
 
+// queryTemplate is a query split around its '?' placeholders. Placeholders inside
+// quoted strings or identifiers are not counted.
+type queryTemplate struct {
+	query    string
+	segments []string // len(segments) == numInput+1
+	numInput int
+}
+
+// parseQueryTemplate scans the query once and records the placeholder positions.
+func parseQueryTemplate(query string) *queryTemplate {
+	tpl := &queryTemplate{query: query}
+	var (
+		quote byte
+		start int
+	)
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		if quote != 0 {
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+			continue
+		}
+		switch c {
+		case '\'', '"', '`':
+			quote = c
+		case '?':
+			tpl.segments = append(tpl.segments, query[start:i])
+			start = i + 1
+		}
+	}
+	tpl.segments = append(tpl.segments, query[start:])
+	tpl.numInput = len(tpl.segments) - 1
+	return tpl
+}
+
+// stringEscaper escapes a string argument inside single quotes, a backslash
+// escapes the next character of quoted text, see parseQueryTemplate.
+var stringEscaper = strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+
+// format replaces the placeholders by the literal form of args, time values are
+// converted to loc.
+func (tpl *queryTemplate) format(args []driver.Value, loc *time.Location) (string, error) {
+	if len(args) != tpl.numInput {
+		return "", driver.ErrSkip
+	}
+	if tpl.numInput == 0 {
+		return tpl.query, nil
+	}
+	var b strings.Builder
+	b.Grow(len(tpl.query) + 16*len(args))
+	for i, arg := range args {
+		b.WriteString(tpl.segments[i])
+		switch v := arg.(type) {
+		case int, uint8, int8, uint16, int16, uint32, int32, int64, uint64:
+			fmt.Fprintf(&b, "%v", v)
+		case float32, float64:
+			// TODO: 可能需要优化
+			fmt.Fprintf(&b, "%v", v)
+		case bool:
+			if v {
+				b.WriteString("true")
+			} else {
+				b.WriteString("false")
+			}
+		case string:
+			b.WriteByte('\'')
+			stringEscaper.WriteString(&b, v)
+			b.WriteByte('\'')
+		case time.Time:
+			// the zero time is bound as NULL, others in the zone of the server
+			if v.IsZero() {
+				b.WriteString("NULL")
+			} else {
+				fmt.Fprintf(&b, "'%s'", v.In(loc).Format("2006-01-02 15:04:05.000"))
+			}
+		case []byte:
+			if v != nil {
+				return "", BinaryArgsUnsupported
+			}
+			b.WriteString("NULL")
+		default:
+			if v == nil {
+				b.WriteString("NULL")
+			} else {
+				return "", driver.ErrSkip
+			}
+		}
+	}
+	b.WriteString(tpl.segments[tpl.numInput])
+	return b.String(), nil
+}
+
+// statementKeyword returns the upper-cased first keyword of query.
+func statementKeyword(query string) string {
+	query = strings.TrimLeft(query, " \t\r\n(")
+	end := strings.IndexAny(query, " \t\r\n(;")
+	if end == -1 {
+		end = len(query)
+	}
+	return strings.ToUpper(query[:end])
+}
+
+// isReadStatement reports whether query only reads data from the server.
+func isReadStatement(query string) bool {
+	switch statementKeyword(query) {
+	case "SELECT", "SHOW", "DESC", "DESCRIBE", "EXPLAIN":
+		return true
+	default:
+		return false
+	}
+}
+
+// templateCache is a LRU cache of parsed query templates shared by all connections.
+type templateCache struct {
+	mu      sync.Mutex
+	ll      *list.List
+	entries map[string]*list.Element
+	size    int
+}
+
+func newTemplateCache(size int) *templateCache {
+	return &templateCache{
+		ll:      list.New(),
+		entries: make(map[string]*list.Element),
+		size:    size,
+	}
+}
+
+// get returns the cached template of query, parsing it on a miss.
+func (tc *templateCache) get(query string) *queryTemplate {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	if e, ok := tc.entries[query]; ok {
+		tc.ll.MoveToFront(e)
+		return e.Value.(*queryTemplate)
+	}
+	tpl := parseQueryTemplate(query)
+	tc.entries[query] = tc.ll.PushFront(tpl)
+	if tc.ll.Len() > tc.size {
+		oldest := tc.ll.Back()
+		tc.ll.Remove(oldest)
+		delete(tc.entries, oldest.Value.(*queryTemplate).query)
+	}
+	return tpl
+}
+
+var (
+	queryTemplates = newTemplateCache(maxCachedTemplates)
+)
+
+type rtdbStmt struct {
+	rc  *rtdbConn
+	tpl *queryTemplate
+}
+
+// Close releases the statement. The parsed template stays in the shared cache.
 func (s *rtdbStmt) Close() error {
-	panic("not implemented")
+	if s.rc == nil {
+		return driver.ErrBadConn
+	}
+	s.rc = nil
+	return nil
 }
 
+// NumInput returns the number of placeholders of the prepared query.
 func (s *rtdbStmt) NumInput() int {
-	panic("not implemented")
+	return s.tpl.numInput
+}
+
+// Deprecated: Drivers should implement StmtExecContext instead.
+func (s *rtdbStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.exec(context.Background(), args)
 }
 
-func (s *rtdbStmt) Exec(args driver.Value) (driver.Result, error) {
-	panic("not implemented")
+func (s *rtdbStmt) exec(ctx context.Context, args []driver.Value) (driver.Result, error) {
+	rc := s.rc
+	if rc == nil || rc.closed.IsSet() {
+		rc.logf("err: rtdb is closed")
+		return nil, driver.ErrBadConn
+	}
+	query, err := s.tpl.format(args, rc.location())
+	if err != nil {
+		return nil, err
+	}
+	return rc.execQuery(ctx, query)
 }
 
+// Deprecated: Drivers should implement StmtQueryContext instead.
 func (s *rtdbStmt) Query(args []driver.Value) (driver.Rows, error) {
-	panic("not implemented")
+	return s.query(context.Background(), args)
+}
+
+func (s *rtdbStmt) query(ctx context.Context, args []driver.Value) (*rtdbRows, error) {
+	rc := s.rc
+	if rc == nil || rc.closed.IsSet() {
+		rc.logf("err: rtdb is closed")
+		return nil, driver.ErrBadConn
+	}
+	query, err := s.tpl.format(args, rc.location())
+	if err != nil {
+		return nil, err
+	}
+	return rc.queryQuery(ctx, query)
+}
+
+func (s *rtdbStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	var result driver.Result
+	values, err := namedValueToValue(args)
+	if err != nil {
+		return nil, err
+	}
+	if s.rc == nil {
+		return nil, driver.ErrBadConn
+	}
+	if err = s.rc.withStatement(ctx, s.tpl.query, func() error {
+		var err error
+		result, err = s.exec(ctx, values)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (s *rtdbStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	var rows driver.Rows
+	values, err := namedValueToValue(args)
+	if err != nil {
+		return nil, err
+	}
+	if s.rc == nil {
+		return nil, driver.ErrBadConn
+	}
+	if err = s.rc.withStatement(ctx, s.tpl.query, func() error {
+		var err error
+		rows, err = s.query(ctx, values)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	return rows, nil
 }
@@ -0,0 +1,112 @@
+package rtdb
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// go test -timeout 30s -run ^Test_parseQueryTemplate$ github.com/racetopdb/gortdb/rtdb -v
+func Test_parseQueryTemplate(t *testing.T) {
+	Convey("Test_parseQueryTemplate", t, func(ctx C) {
+		Convey("Placeholders inside quotes should be ignored", func(ctx C) {
+			var testQueries = []struct {
+				query    string
+				numInput int
+			}{
+				{"SHOW DATABASES;", 0},
+				{"select * from t where time between ? and ?", 2},
+				{"select * from t where name = '?' and age = ?", 1},
+				{"select * from t where name = 'it\\'s ?' and age = ?", 1},
+				{"select * from \"a?b\" where age = ?", 1},
+				{"insert into t(a, b) values(?,?)", 2},
+			}
+			for _, tq := range testQueries {
+				tpl := parseQueryTemplate(tq.query)
+				So(tpl.numInput, ShouldEqual, tq.numInput)
+				So(len(tpl.segments), ShouldEqual, tq.numInput+1)
+			}
+		})
+
+		Convey("Format should replace placeholders in order", func(ctx C) {
+			tpl := parseQueryTemplate("select * from t where name = '?' and age = ? and ok = ?")
+			query, err := tpl.format([]driver.Value{int64(12), true}, time.UTC)
+			So(err, ShouldBeNil)
+			So(query, ShouldEqual, "select * from t where name = '?' and age = 12 and ok = true")
+
+			_, err = tpl.format([]driver.Value{int64(12)}, time.UTC)
+			So(err, ShouldEqual, driver.ErrSkip)
+		})
+
+		Convey("Quotes and backslashes of strings should be escaped", func(ctx C) {
+			tpl := parseQueryTemplate("select * from t where name = ? and id = ?")
+			query, err := tpl.format([]driver.Value{`it's a \' or 1=1 -- \`, int64(1)}, time.UTC)
+			So(err, ShouldBeNil)
+			So(query, ShouldEqual, `select * from t where name = 'it\'s a \\\' or 1=1 -- \\' and id = 1`)
+			// the placeholders after the argument are still found
+			So(parseQueryTemplate(query+" and x = ?").numInput, ShouldEqual, 1)
+		})
+
+		Convey("Binary values should be rejected, a nil one bound as NULL", func(ctx C) {
+			tpl := parseQueryTemplate("insert into t(frame) values(?)")
+			query, err := tpl.format([]driver.Value{[]byte(nil)}, time.UTC)
+			So(err, ShouldBeNil)
+			So(query, ShouldEqual, "insert into t(frame) values(NULL)")
+			_, err = tpl.format([]driver.Value{[]byte{0x00, 0x1b, 0xff}}, time.UTC)
+			So(err, ShouldEqual, BinaryArgsUnsupported)
+			_, err = tpl.format([]driver.Value{[]byte{}}, time.UTC)
+			So(err, ShouldEqual, BinaryArgsUnsupported)
+		})
+
+		Convey("Time values should be bound in the zone of the server", func(ctx C) {
+			shanghai := time.FixedZone("CST", 8*3600)
+			tpl := parseQueryTemplate("select * from t where time between ? and ?")
+			start := time.Date(2021, 1, 1, 0, 0, 0, 123456789, time.UTC)
+			query, err := tpl.format([]driver.Value{start, time.Time{}}, shanghai)
+			So(err, ShouldBeNil)
+			So(query, ShouldEqual, "select * from t where time between '2021-01-01 08:00:00.123' and NULL")
+		})
+	})
+}
+
+// go test -timeout 30s -run ^Test_templateCache$ github.com/racetopdb/gortdb/rtdb -v
+func Test_templateCache(t *testing.T) {
+	Convey("Test_templateCache", t, func(ctx C) {
+		Convey("The same query should reuse the cached template", func(ctx C) {
+			cache := newTemplateCache(2)
+			tpl := cache.get("select * from t where a = ?")
+			So(cache.get("select * from t where a = ?"), ShouldEqual, tpl)
+		})
+
+		Convey("The least recently used template should be evicted", func(ctx C) {
+			cache := newTemplateCache(2)
+			tpl := cache.get("q1 ?")
+			cache.get("q2 ?")
+			cache.get("q3 ?")
+			So(cache.ll.Len(), ShouldEqual, 2)
+			So(cache.get("q1 ?"), ShouldNotEqual, tpl)
+		})
+	})
+}
+
+// go test -timeout 30s -run ^Test_rtdbConn_PrepareContext$ github.com/racetopdb/gortdb/rtdb -v
+func Test_rtdbConn_PrepareContext(t *testing.T) {
+	Convey("Test_rtdbConn_PrepareContext", t, func(ctx C) {
+		conn := &rtdbConn{closech: make(chan int)}
+		Convey("NumInput should report the real placeholder count", func(ctx C) {
+			stmt, err := conn.PrepareContext(context.Background(), "select * from t where time between ? and ?")
+			So(err, ShouldBeNil)
+			So(stmt.NumInput(), ShouldEqual, 2)
+			So(stmt.Close(), ShouldBeNil)
+		})
+
+		Convey("Prepare on a closed connection should return driver.ErrBadConn", func(ctx C) {
+			conn.closed.Set(true)
+			_, err := conn.PrepareContext(context.Background(), "SHOW DATABASES;")
+			So(err, ShouldEqual, driver.ErrBadConn)
+		})
+	})
+}
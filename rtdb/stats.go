@@ -0,0 +1,44 @@
+package rtdb
+
+import "sync/atomic"
+
+// NativeMemStats is a snapshot of the native memory held by the driver.
+type NativeMemStats struct {
+	LiveResults int64 // result sets stored by libtsdb and not freed yet
+	LiveClients int64 // client handles allocated by tsdb_new and not killed yet
+	BytesHeld   int64 // estimated size of the live result sets in bytes
+}
+
+var (
+	liveResults int64
+	liveClients int64
+	bytesHeld   int64
+)
+
+// NativeStats returns the native memory currently held by the driver, tests can
+// use it to assert that nothing leaks once all rows and connections are closed.
+func NativeStats() NativeMemStats {
+	return NativeMemStats{
+		LiveResults: atomic.LoadInt64(&liveResults),
+		LiveClients: atomic.LoadInt64(&liveClients),
+		BytesHeld:   atomic.LoadInt64(&bytesHeld),
+	}
+}
+
+func trackResult(bytes int64) {
+	atomic.AddInt64(&liveResults, 1)
+	atomic.AddInt64(&bytesHeld, bytes)
+}
+
+func untrackResult(bytes int64) {
+	atomic.AddInt64(&liveResults, -1)
+	atomic.AddInt64(&bytesHeld, -bytes)
+}
+
+func trackClient() {
+	atomic.AddInt64(&liveClients, 1)
+}
+
+func untrackClient() {
+	atomic.AddInt64(&liveClients, -1)
+}
@@ -0,0 +1,43 @@
+//go:build cgo
+// +build cgo
+
+package rtdb
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// go test -timeout 30s -run ^TestNativeStats$ github.com/racetopdb/gortdb/rtdb -v
+func TestNativeStats(t *testing.T) {
+	Convey("TestNativeStats", t, func(ctx C) {
+		before := NativeStats()
+		Convey("Clean up should release the client handle", func(ctx C) {
+			a := NewRtdbAdapter("127.0.0.1", 9000, "test", "test")
+			So(NativeStats().LiveClients, ShouldEqual, before.LiveClients+1)
+			So(a.CleanUp(), ShouldBeNil)
+			So(a.CleanUp(), ShouldBeNil)
+			So(NativeStats(), ShouldResemble, before)
+		})
+
+		Convey("Closing a connection should release its client handle", func(ctx C) {
+			c := &connector{config: &Config{User: "test", Password: "test", Address: "127.0.0.1:9000"}}
+			conn, err := c.Connect(context.Background())
+			So(err, ShouldBeNil)
+			So(NativeStats().LiveClients, ShouldEqual, before.LiveClients+1)
+			So(conn.Close(), ShouldBeNil)
+			So(NativeStats(), ShouldResemble, before)
+		})
+
+		Convey("A failed connect should not leak its client handle", func(ctx C) {
+			c := &connector{config: &Config{User: "test", Password: "test", Address: "127.0.0.1:9000"}}
+			cancelCtx, cancel := context.WithCancel(context.Background())
+			cancel()
+			_, err := c.Connect(cancelCtx)
+			So(err, ShouldEqual, context.Canceled)
+			So(NativeStats(), ShouldResemble, before)
+		})
+	})
+}
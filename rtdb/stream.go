@@ -0,0 +1,285 @@
+package rtdb
+
+import (
+	"context"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultStreamWindow is the chunk size used when streaming is enabled without a window.
+	defaultStreamWindow = time.Hour
+)
+
+// StreamProgress describes how far a streaming query has been read.
+type StreamProgress struct {
+	Rows       uint64    // rows returned to the caller so far
+	Chunk      int       // number of chunks read so far
+	Chunks     int       // total number of chunks of the query
+	ChunkStart time.Time // time range of the last chunk read, zero when the query is not split
+	ChunkEnd   time.Time
+}
+
+// StreamOptions configures the streaming mode of a query.
+//
+// libtsdb stores the whole result of a query in native memory, so a streaming
+// query is split by its "time BETWEEN ... AND ..." range into chunks of Window,
+// only one chunk is held at a time and it is freed as soon as the caller reads
+// past it. The memory is bounded by the rows of one Window, not by a row count.
+//
+// Only plain row selects are split: the results of aggregates, LIMIT, ORDER BY,
+// GROUP BY, DISTINCT and LAST/FIRST differ when they are computed per chunk, such
+// queries and queries without a time range are read in one chunk.
+type StreamOptions struct {
+	Window   time.Duration        // time range of one chunk
+	Progress func(StreamProgress) // called after every chunk, may be nil
+}
+
+type streamOptionsKey struct{}
+
+// WithStreaming returns a context which enables the streaming mode for the
+// queries executed with it, overriding the streamWindow DSN parameter.
+func WithStreaming(ctx context.Context, opts StreamOptions) context.Context {
+	return context.WithValue(ctx, streamOptionsKey{}, opts)
+}
+
+// streamOptions returns the streaming options of a query, from ctx first and then
+// from the DSN.
+func (rc *rtdbConn) streamOptions(ctx context.Context) (StreamOptions, bool) {
+	var window time.Duration
+	if rc.config != nil {
+		window = rc.config.StreamWindow
+	}
+	if ctx != nil {
+		if opts, ok := ctx.Value(streamOptionsKey{}).(StreamOptions); ok {
+			if opts.Window <= 0 {
+				opts.Window = window
+			}
+			if opts.Window <= 0 {
+				opts.Window = defaultStreamWindow
+			}
+			return opts, true
+		}
+	}
+	if window > 0 {
+		return StreamOptions{Window: window}, true
+	}
+	return StreamOptions{}, false
+}
+
+var (
+	timeRangeRegexp = regexp.MustCompile(`(?i)\btime\s+between\s+('[^']*'|\d+)\s+and\s+('[^']*'|\d+)`)
+)
+
+// chunkBoundLayout is the layout of the quoted bounds of the chunks.
+const chunkBoundLayout = "2006-01-02 15:04:05.000"
+
+var timeLiteralLayouts = []string{
+	"2006-01-02 15:04:05.000",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+// timeLiteral is a datetime literal of a query, either quoted text or epoch milliseconds.
+type timeLiteral struct {
+	layout string // empty for epoch milliseconds
+}
+
+func (tl timeLiteral) parse(s string, loc *time.Location) (time.Time, bool) {
+	if s[0] != '\'' {
+		ms, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return time.Time{}, false
+		}
+		return time.Unix(ms/1000, (ms%1000)*int64(time.Millisecond)).In(loc), true
+	}
+	t, err := time.ParseInLocation(tl.layout, s[1:len(s)-1], loc)
+	return t, err == nil
+}
+
+// format writes a chunk bound. Quoted bounds always have millisecond precision
+// whatever the layout of the literals of the query, a coarser layout would cut the
+// end of a chunk and lose the rows between it and the start of the next one.
+func (tl timeLiteral) format(t time.Time) string {
+	if tl.layout == "" {
+		return strconv.FormatInt(t.UnixNano()/int64(time.Millisecond), 10)
+	}
+	return "'" + t.Format(chunkBoundLayout) + "'"
+}
+
+// rowStream splits a query into chunks by its time range.
+type rowStream struct {
+	opts     StreamOptions
+	query    string // the query when it can not be split
+	prefix   string // query before the time range
+	suffix   string // query after the time range
+	literal  timeLiteral
+	end      time.Time
+	next     time.Time // start of the next chunk
+	progress StreamProgress
+	ctx      context.Context // context of the query, the following chunks run with it
+}
+
+func newRowStream(query string, opts StreamOptions, loc *time.Location) *rowStream {
+	s := &rowStream{opts: opts, query: query}
+	s.progress.Chunks = 1
+	if loc == nil {
+		loc = time.UTC
+	}
+	if !splittable(query) {
+		return s
+	}
+	m := timeRangeRegexp.FindStringSubmatchIndex(query)
+	if m == nil {
+		return s
+	}
+	from, to := query[m[2]:m[3]], query[m[4]:m[5]]
+	for _, tl := range literalsOf(from) {
+		start, ok1 := tl.parse(from, loc)
+		end, ok2 := tl.parse(to, loc)
+		if !ok1 || !ok2 || end.Before(start) {
+			continue
+		}
+		s.prefix, s.suffix = query[:m[0]], query[m[1]:]
+		s.literal = tl
+		s.next, s.end = start, end
+		s.progress.Chunks = int(end.Sub(start)/opts.Window) + 1
+		s.query = ""
+		break
+	}
+	return s
+}
+
+var (
+	// unsplittableKeywords change the result of a query when it is split by time
+	unsplittableKeywords = map[string]bool{
+		"LIMIT": true, "ORDER": true, "GROUP": true, "HAVING": true, "DISTINCT": true,
+		"LAST": true, "FIRST": true, "UNION": true,
+	}
+	// aggregateFunctions compute one value of all the rows of a query
+	aggregateFunctions = map[string]bool{
+		"COUNT": true, "SUM": true, "AVG": true, "MIN": true, "MAX": true,
+		"STDDEV": true, "SPREAD": true, "MEDIAN": true, "PERCENTILE": true, "TOP": true, "BOTTOM": true,
+	}
+)
+
+// splittable reports whether query is a plain row select whose result is the same
+// when it is read in time chunks. Words in quoted strings and identifiers are ignored.
+func splittable(query string) bool {
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			for i++; i < len(query) && query[i] != c; i++ {
+				if query[i] == '\\' {
+					i++
+				}
+			}
+		case isIdentByte(c):
+			start := i
+			for i+1 < len(query) && isIdentByte(query[i+1]) {
+				i++
+			}
+			word := strings.ToUpper(query[start : i+1])
+			if unsplittableKeywords[word] {
+				return false
+			}
+			if aggregateFunctions[word] && strings.HasPrefix(strings.TrimLeft(query[i+1:], " \t\r\n"), "(") {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func literalsOf(s string) []timeLiteral {
+	if s[0] != '\'' {
+		return []timeLiteral{{}}
+	}
+	literals := make([]timeLiteral, 0, len(timeLiteralLayouts))
+	for _, layout := range timeLiteralLayouts {
+		literals = append(literals, timeLiteral{layout: layout})
+	}
+	return literals
+}
+
+// nextQuery returns the query of the next chunk, false when all chunks are read.
+// BETWEEN includes both bounds, so a chunk ends one millisecond before the next one.
+func (s *rowStream) nextQuery() (string, bool) {
+	if s.progress.Chunk >= s.progress.Chunks {
+		return "", false
+	}
+	s.progress.Chunk++
+	if s.query != "" {
+		return s.query, true
+	}
+	start := s.next
+	end := start.Add(s.opts.Window - time.Millisecond)
+	if end.After(s.end) || s.progress.Chunk == s.progress.Chunks {
+		end = s.end
+	}
+	s.next = start.Add(s.opts.Window)
+	s.progress.ChunkStart, s.progress.ChunkEnd = start, end
+	return s.prefix + "time BETWEEN " + s.literal.format(start) + " AND " + s.literal.format(end) + s.suffix, true
+}
+
+// report calls the progress callback once a chunk has been read.
+func (s *rowStream) report() {
+	if s.opts.Progress != nil {
+		s.opts.Progress(s.progress)
+	}
+}
+
+// streamQuery executes the first non empty chunk of a streaming query, the
+// following chunks are executed by rtdbRows when the previous one is read.
+func (rc *rtdbConn) streamQuery(ctx context.Context, query string, opts StreamOptions) (*rtdbRows, error) {
+	var loc *time.Location
+	if rc.config != nil {
+		loc = rc.config.Location
+	}
+	s := newRowStream(query, opts, loc)
+	s.ctx = ctx
+	for {
+		chunkQuery, ok := s.nextQuery()
+		if !ok {
+			return &rtdbRows{}, nil
+		}
+		rows, err := rc.fetchQuery(ctx, chunkQuery)
+		if err != nil {
+			return nil, err
+		}
+		if !rows.readDone() {
+			rows.stream = s
+			return rows, nil
+		}
+		s.report()
+		if err := rc.freeResult(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// nextChunk frees the chunk which has been read and executes the next non empty
+// one. It returns false when there are no more chunks.
+func (r *rtdbRows) nextChunk() (bool, error) {
+	rc, s := r.rc, r.stream
+	for {
+		s.report()
+		if err := rc.freeResult(); err != nil {
+			return false, err
+		}
+		chunkQuery, ok := s.nextQuery()
+		if !ok {
+			return false, nil
+		}
+		rows, err := rc.fetchQuery(s.ctx, chunkQuery)
+		if err != nil {
+			return false, err
+		}
+		if !rows.readDone() {
+			return true, nil
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package rtdb
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// go test -timeout 30s -run ^Test_newRowStream$ github.com/racetopdb/gortdb/rtdb -v
+func Test_newRowStream(t *testing.T) {
+	Convey("Test_newRowStream", t, func(ctx C) {
+		opts := StreamOptions{Window: time.Hour}
+		Convey("A time range should be split into chunks of the window", func(ctx C) {
+			s := newRowStream("select * from t where time between '2021-01-01 00:00:00.000' and '2021-01-01 02:30:00.000' and a = 1", opts, time.UTC)
+			So(s.progress.Chunks, ShouldEqual, 3)
+			var queries []string
+			for {
+				query, ok := s.nextQuery()
+				if !ok {
+					break
+				}
+				queries = append(queries, query)
+			}
+			So(queries, ShouldResemble, []string{
+				"select * from t where time BETWEEN '2021-01-01 00:00:00.000' AND '2021-01-01 00:59:59.999' and a = 1",
+				"select * from t where time BETWEEN '2021-01-01 01:00:00.000' AND '2021-01-01 01:59:59.999' and a = 1",
+				"select * from t where time BETWEEN '2021-01-01 02:00:00.000' AND '2021-01-01 02:30:00.000' and a = 1",
+			})
+		})
+
+		Convey("Chunk bounds should have millisecond precision whatever the literals", func(ctx C) {
+			for _, c := range []struct {
+				query  string
+				window time.Duration
+				chunks []string
+			}{
+				{"select * from t where time between '2021-01-01 00:00:00' and '2021-01-01 02:00:00'", time.Hour, []string{
+					"'2021-01-01 00:00:00.000' AND '2021-01-01 00:59:59.999'",
+					"'2021-01-01 01:00:00.000' AND '2021-01-01 01:59:59.999'",
+					"'2021-01-01 02:00:00.000' AND '2021-01-01 02:00:00.000'",
+				}},
+				{"select * from t where time between '2021-01-01' and '2021-01-03'", 24 * time.Hour, []string{
+					"'2021-01-01 00:00:00.000' AND '2021-01-01 23:59:59.999'",
+					"'2021-01-02 00:00:00.000' AND '2021-01-02 23:59:59.999'",
+					"'2021-01-03 00:00:00.000' AND '2021-01-03 00:00:00.000'",
+				}},
+			} {
+				s := newRowStream(c.query, StreamOptions{Window: c.window}, time.UTC)
+				var chunks []string
+				for {
+					query, ok := s.nextQuery()
+					if !ok {
+						break
+					}
+					chunks = append(chunks, strings.TrimPrefix(query, "select * from t where time BETWEEN "))
+				}
+				So(chunks, ShouldResemble, c.chunks)
+			}
+		})
+
+		Convey("Epoch milliseconds should be split too", func(ctx C) {
+			s := newRowStream("SELECT * FROM t WHERE TIME BETWEEN 0 AND 7200000", opts, time.UTC)
+			So(s.progress.Chunks, ShouldEqual, 3)
+			query, _ := s.nextQuery()
+			So(query, ShouldEqual, "SELECT * FROM t WHERE time BETWEEN 0 AND 3599999")
+			s.nextQuery()
+			query, _ = s.nextQuery()
+			So(query, ShouldEqual, "SELECT * FROM t WHERE time BETWEEN 7200000 AND 7200000")
+		})
+
+		Convey("Queries whose result depends on all the rows should not be split", func(ctx C) {
+			const where = " from t where time between 0 and 7200000"
+			for _, query := range []string{
+				"select count(*)" + where,
+				"select avg(v), sum(v)" + where,
+				"select MAX (v)" + where,
+				"select *" + where + " limit 10",
+				"select *" + where + " order by time desc",
+				"select last *" + where,
+				"select last(v)" + where,
+				"select distinct a" + where,
+				"select a, count(*)" + where + " group by a",
+			} {
+				s := newRowStream(query, opts, time.UTC)
+				So(s.progress.Chunks, ShouldEqual, 1)
+				chunk, ok := s.nextQuery()
+				So(ok, ShouldBeTrue)
+				So(chunk, ShouldEqual, query)
+				_, ok = s.nextQuery()
+				So(ok, ShouldBeFalse)
+			}
+		})
+
+		Convey("Keywords in strings and column names should not prevent the split", func(ctx C) {
+			So(splittable("select last_value, counter from t where name = 'order by' and time between 0 and 1"), ShouldBeTrue)
+			So(splittable("select count from t where time between 0 and 1"), ShouldBeTrue)
+			So(newRowStream("select * from t where note = 'limit 1' and time between 0 and 7200000", opts, time.UTC).progress.Chunks, ShouldEqual, 3)
+		})
+
+		Convey("A query without a time range should be read in one chunk", func(ctx C) {
+			var progress []StreamProgress
+			s := newRowStream("select last * from t", StreamOptions{Window: time.Hour, Progress: func(p StreamProgress) {
+				progress = append(progress, p)
+			}}, time.UTC)
+			query, ok := s.nextQuery()
+			So(ok, ShouldBeTrue)
+			So(query, ShouldEqual, "select last * from t")
+			s.report()
+			_, ok = s.nextQuery()
+			So(ok, ShouldBeFalse)
+			So(progress, ShouldResemble, []StreamProgress{{Chunk: 1, Chunks: 1}})
+		})
+	})
+}
+
+// go test -timeout 30s -run ^Test_rtdbConn_streamOptions$ github.com/racetopdb/gortdb/rtdb -v
+func Test_rtdbConn_streamOptions(t *testing.T) {
+	Convey("Test_rtdbConn_streamOptions", t, func(ctx C) {
+		config, err := ParseDSN("/dbname?streamWindow=30m")
+		So(err, ShouldBeNil)
+		So(config.StreamWindow, ShouldEqual, 30*time.Minute)
+
+		conn := &rtdbConn{config: config}
+		opts, ok := conn.streamOptions(context.Background())
+		So(ok, ShouldBeTrue)
+		So(opts.Window, ShouldEqual, 30*time.Minute)
+
+		opts, ok = conn.streamOptions(WithStreaming(context.Background(), StreamOptions{Window: time.Minute}))
+		So(ok, ShouldBeTrue)
+		So(opts.Window, ShouldEqual, time.Minute)
+
+		conn = &rtdbConn{config: NewConfig()}
+		_, ok = conn.streamOptions(context.Background())
+		So(ok, ShouldBeFalse)
+		opts, ok = conn.streamOptions(WithStreaming(context.Background(), StreamOptions{}))
+		So(ok, ShouldBeTrue)
+		So(opts.Window, ShouldEqual, defaultStreamWindow)
+	})
+}
@@ -0,0 +1,69 @@
+package rtdb
+
+import (
+	"crypto/tls"
+	"errors"
+	"sync"
+)
+
+var (
+	tlsConfigsMu sync.RWMutex
+	tlsConfigs   map[string]*tls.Config
+)
+
+// RegisterTLSConfig registers a TLS configuration under name, the DSN selects it
+// with tls=name. The names true, false and skip-verify are reserved.
+func RegisterTLSConfig(name string, config *tls.Config) error {
+	switch name {
+	case "", "true", "false", "skip-verify":
+		return errors.New("rtdb: TLS config name is reserved: " + name)
+	}
+	if config == nil {
+		return errors.New("rtdb: TLS config is nil")
+	}
+	tlsConfigsMu.Lock()
+	defer tlsConfigsMu.Unlock()
+	if tlsConfigs == nil {
+		tlsConfigs = make(map[string]*tls.Config)
+	}
+	tlsConfigs[name] = config.Clone()
+	return nil
+}
+
+// DeregisterTLSConfig removes the TLS configuration registered under name.
+func DeregisterTLSConfig(name string) {
+	tlsConfigsMu.Lock()
+	defer tlsConfigsMu.Unlock()
+	delete(tlsConfigs, name)
+}
+
+// parseTLS returns the TLS configuration of the tls DSN parameter, nil when TLS
+// is disabled.
+func parseTLS(value string) (*tls.Config, error) {
+	switch value {
+	case "", "false":
+		return nil, nil
+	case "true":
+		return &tls.Config{}, nil
+	case "skip-verify":
+		return &tls.Config{InsecureSkipVerify: true}, nil
+	}
+	tlsConfigsMu.RLock()
+	defer tlsConfigsMu.RUnlock()
+	config, ok := tlsConfigs[value]
+	if !ok {
+		return nil, errors.New("unknown TLS config, register it with RegisterTLSConfig")
+	}
+	return config.Clone(), nil
+}
+
+// tlsForHost returns the TLS configuration of a connection to host, verifying
+// the name of host when the configuration has no ServerName.
+func tlsForHost(config *tls.Config, host string) *tls.Config {
+	if config == nil || config.ServerName != "" || config.InsecureSkipVerify {
+		return config
+	}
+	config = config.Clone()
+	config.ServerName, _ = (&Config{Address: host}).HostAndPort()
+	return config
+}
@@ -0,0 +1,81 @@
+package rtdb
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// go test -timeout 30s -run ^TestRegisterTLSConfig$ github.com/racetopdb/gortdb/rtdb -v
+func TestRegisterTLSConfig(t *testing.T) {
+	Convey("TestRegisterTLSConfig", t, func(ctx C) {
+		So(RegisterTLSConfig("custom", &tls.Config{MinVersion: tls.VersionTLS12}), ShouldBeNil)
+		defer DeregisterTLSConfig("custom")
+
+		Convey("Reserved names and nil configs should be rejected", func(ctx C) {
+			So(RegisterTLSConfig("true", &tls.Config{}), ShouldNotBeNil)
+			So(RegisterTLSConfig("skip-verify", &tls.Config{}), ShouldNotBeNil)
+			So(RegisterTLSConfig("other", nil), ShouldNotBeNil)
+		})
+
+		Convey("The tls parameter should select the TLS configuration", func(ctx C) {
+			config, err := ParseDSN("/dbname")
+			So(err, ShouldBeNil)
+			So(config.TLS, ShouldBeNil)
+
+			config, err = ParseDSN("/dbname?tls=false")
+			So(err, ShouldBeNil)
+			So(config.TLS, ShouldBeNil)
+
+			config, err = ParseDSN("/dbname?tls=true")
+			So(err, ShouldBeNil)
+			So(config.TLS, ShouldNotBeNil)
+			So(config.TLS.InsecureSkipVerify, ShouldBeFalse)
+
+			config, err = ParseDSN("/dbname?tls=skip-verify")
+			So(err, ShouldBeNil)
+			So(config.TLS.InsecureSkipVerify, ShouldBeTrue)
+
+			config, err = ParseDSN("/dbname?tls=custom")
+			So(err, ShouldBeNil)
+			So(config.TLS.MinVersion, ShouldEqual, tls.VersionTLS12)
+			So(config.FormatDSN(), ShouldEndWith, "/dbname?tls=custom")
+
+			_, err = ParseDSN("/dbname?tls=missing")
+			var perr *ParseError
+			So(errors.As(err, &perr), ShouldBeTrue)
+			So(perr.Part, ShouldEqual, "tls")
+		})
+
+		Convey("The server name should default to the host", func(ctx C) {
+			So(tlsForHost(nil, "h1:9000"), ShouldBeNil)
+			So(tlsForHost(&tls.Config{}, "h1:9000").ServerName, ShouldEqual, "h1")
+			So(tlsForHost(&tls.Config{ServerName: "db"}, "h1:9000").ServerName, ShouldEqual, "db")
+		})
+
+		Convey("The native backend should not fall back to a plain text link", func(ctx C) {
+			if nativeBackend == nil {
+				return
+			}
+			config, err := ParseDSN("test:test@tcp(127.0.0.1:9000)/?tls=true")
+			So(err, ShouldBeNil)
+			_, err = newConnector(config).Connect(context.Background())
+			So(errors.Is(err, TLSUnsupported), ShouldBeTrue)
+
+			// certificates of a registered configuration do not change it
+			So(RegisterTLSConfig("native", &tls.Config{ServerName: "db"}), ShouldBeNil)
+			defer DeregisterTLSConfig("native")
+			config, err = ParseDSN("test:test@tcp(127.0.0.1:9000)/?tls=native")
+			So(err, ShouldBeNil)
+			_, err = newConnector(config).Connect(context.Background())
+			So(errors.Is(err, TLSUnsupported), ShouldBeTrue)
+			info, ierr := LibraryInfo()
+			if ierr == nil {
+				So(err.Error(), ShouldContainSubstring, info.Path)
+			}
+		})
+	})
+}
@@ -0,0 +1,76 @@
+// Go Rtdb Driver - A Rtdb-Driver for Go's database/sql pacakge.
+package rtdb
+
+import (
+	"context"
+	"database/sql/driver"
+	"strings"
+)
+
+// rtdbTx is a client side write batch. rtdb has no server side transaction, so
+// write statements executed during the transaction are buffered and sent on
+// Commit, Rollback just throws them away. Read statements are executed
+// immediately and do not see the buffered writes.
+//
+// Commit is not atomic: the statements are sent one by one in order and the first
+// failing statement stops the commit, the statements before it stay applied, see
+// CommitError. They are not joined into one batch, libtsdb has no batch call and
+// does not document how several statements of one query are executed or which
+// of them failed, so the applied statements could not be reported. The results of the buffered statements are not known when they are
+// executed, their RowsAffected and LastInsertId return TxResultUnknown.
+type rtdbTx struct {
+	rc    *rtdbConn
+	stmts []string
+}
+
+// buffer appends a write statement to the batch.
+func (tx *rtdbTx) buffer(query string) {
+	query = strings.TrimRight(strings.TrimSpace(query), ";")
+	if query == "" {
+		return
+	}
+	tx.stmts = append(tx.stmts, query)
+}
+
+func (tx *rtdbTx) Commit() error {
+	rc := tx.rc
+	if rc == nil {
+		return TxDone
+	}
+	tx.rc = nil
+	rc.tx = nil
+	if rc.closed.IsSet() {
+		rc.logf("err: rtdb is closed")
+		return driver.ErrBadConn
+	}
+	stmts := tx.stmts
+	tx.stmts = nil
+	if len(stmts) == 0 {
+		return nil
+	}
+	return rc.withTimeout(context.Background(), "write", rc.writeTimeout(), func() error {
+		for i, stmt := range stmts {
+			if err := rc.execStatement(context.Background(), stmt); err != nil {
+				return &CommitError{Applied: i, Total: len(stmts), Err: err}
+			}
+			if err := rc.freeResult(); err != nil {
+				return &CommitError{Applied: i + 1, Total: len(stmts), Err: err}
+			}
+		}
+		return nil
+	})
+}
+
+func (tx *rtdbTx) Rollback() error {
+	rc := tx.rc
+	if rc == nil {
+		return TxDone
+	}
+	tx.rc = nil
+	rc.tx = nil
+	tx.stmts = nil
+	if rc.closed.IsSet() {
+		return driver.ErrBadConn
+	}
+	return nil
+}
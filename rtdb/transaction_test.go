@@ -0,0 +1,83 @@
+package rtdb
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// go test -timeout 30s -run ^Test_rtdbConn_BeginTx$ github.com/racetopdb/gortdb/rtdb -v
+func Test_rtdbConn_BeginTx(t *testing.T) {
+	Convey("Test_rtdbConn_BeginTx", t, func(ctx C) {
+		conn := &rtdbConn{closech: make(chan int)}
+		Convey("Unsupported options should return typed errors", func(ctx C) {
+			_, err := conn.BeginTx(context.Background(), driver.TxOptions{Isolation: driver.IsolationLevel(sql.LevelSerializable)})
+			So(err, ShouldEqual, TxIsolationNotSupported)
+			_, err = conn.BeginTx(context.Background(), driver.TxOptions{ReadOnly: true})
+			So(err, ShouldEqual, TxReadOnlyNotSupported)
+		})
+
+		Convey("Write statements should be buffered until the transaction ends", func(ctx C) {
+			tx, err := conn.Begin()
+			So(err, ShouldBeNil)
+			_, err = conn.BeginTx(context.Background(), driver.TxOptions{})
+			So(err, ShouldEqual, TxNested)
+
+			result, err := conn.Exec("insert into t(age) values(?);", []driver.Value{int64(12)})
+			So(err, ShouldBeNil)
+			_, err = result.RowsAffected()
+			So(err, ShouldEqual, TxResultUnknown)
+			_, err = result.LastInsertId()
+			So(err, ShouldEqual, TxResultUnknown)
+			_, err = conn.Exec("insert into t(age) values(13)", nil)
+			So(err, ShouldBeNil)
+			So(conn.tx.stmts, ShouldResemble, []string{"insert into t(age) values(12)", "insert into t(age) values(13)"})
+
+			So(tx.Rollback(), ShouldBeNil)
+			So(conn.tx, ShouldBeNil)
+			So(tx.Commit(), ShouldEqual, TxDone)
+		})
+
+		Convey("Commit should send the statements one by one and stop at the first failure", func(ctx C) {
+			backend := &fakeBackend{results: map[string]fakeResult{
+				"insert into t(age) values(2)": {err: errors.New("table is full")},
+			}, logined: true}
+			conn := &rtdbConn{backend: backend, config: NewConfig(), closech: make(chan int)}
+			tx, err := conn.Begin()
+			So(err, ShouldBeNil)
+			for _, query := range []string{"insert into t(age) values(1)", "insert into t(age) values(2)", "insert into t(age) values(3)"} {
+				_, err = conn.Exec(query, nil)
+				So(err, ShouldBeNil)
+			}
+			So(backend.queries, ShouldBeEmpty)
+			err = tx.Commit()
+			So(err, ShouldBeError, "rtdb: commit failed after 1 of 3 statements: table is full")
+			var cerr *CommitError
+			So(errors.As(err, &cerr), ShouldBeTrue)
+			So(cerr.Applied, ShouldEqual, 1)
+			So(backend.queries, ShouldResemble, []string{"insert into t(age) values(1)", "insert into t(age) values(2)"})
+		})
+
+		Convey("Committing an empty transaction should not touch the server", func(ctx C) {
+			tx, err := conn.Begin()
+			So(err, ShouldBeNil)
+			So(tx.Commit(), ShouldBeNil)
+			So(tx.Rollback(), ShouldEqual, TxDone)
+		})
+	})
+}
+
+// go test -timeout 30s -run ^Test_isReadStatement$ github.com/racetopdb/gortdb/rtdb -v
+func Test_isReadStatement(t *testing.T) {
+	Convey("Test_isReadStatement", t, func(ctx C) {
+		So(isReadStatement("  select last * from t"), ShouldBeTrue)
+		So(isReadStatement("SHOW DATABASES;"), ShouldBeTrue)
+		So(isReadStatement("insert into t(a) values(1)"), ShouldBeFalse)
+		So(isReadStatement("CREATE TABLE IF NOT EXISTS t(a int)"), ShouldBeFalse)
+		So(isReadStatement(""), ShouldBeFalse)
+	})
+}
@@ -0,0 +1,256 @@
+//go:build cgo
+// +build cgo
+
+#include <dlfcn.h>
+#include <stdio.h>
+#include <stddef.h>
+#include <string.h>
+#include <pthread.h>
+
+#include "tsdb_dl.h"
+
+// GORTDB_ENOLIB is returned by the forwarding functions before the library is loaded.
+#define GORTDB_ENOLIB (-1)
+
+struct gortdb_tsdb_api
+{
+    tsdb_ml_t *(*tsdb_new)();
+    void (*tsdb_kill_me)(void *self);
+    int (*tsdb_connect)(const char *conn_str);
+    int (*tsdb_disconnect)();
+    BOOL (*tsdb_is_logined)();
+    const char *(*tsdb_charset_get)();
+    int (*tsdb_query)(void *self, const char *sql, int sql_len, const char *charset, const char *database);
+    tsdb_ml_field_t **(*tsdb_fetch_ml_fields)(void *self, int *field_count);
+    RTDB_RES_SET *(*tsdb_store_result_v2)(void *self);
+    int (*tsdb_free_result)(void *self, void *result);
+
+    // optional, NULL when the library has no TLS client
+    tsdb_ml_t *(*tsdb_tls)();
+
+    // negotiated with tsdb_ml_new_s
+    uint64_t version;
+    char build_version[GORTDB_BUILD_VERSION_LEN];
+};
+
+static struct gortdb_tsdb_api api;
+static void *api_handle = NULL;
+static pthread_mutex_t api_mutex = PTHREAD_MUTEX_INITIALIZER;
+
+#define RESOLVE(handle, table, name)                                                        \
+    do                                                                                      \
+    {                                                                                       \
+        *(void **)(&(table)->name) = dlsym(handle, #name);                                  \
+        if ((table)->name == NULL)                                                          \
+        {                                                                                   \
+            snprintf(err, err_len, "%s: undefined symbol %s", path, #name);                 \
+            return -1;                                                                      \
+        }                                                                                   \
+    } while (0)
+
+static int resolve(void *handle, struct gortdb_tsdb_api *table, const char *path, char *err, int err_len)
+{
+    RESOLVE(handle, table, tsdb_new);
+    RESOLVE(handle, table, tsdb_kill_me);
+    RESOLVE(handle, table, tsdb_connect);
+    RESOLVE(handle, table, tsdb_disconnect);
+    RESOLVE(handle, table, tsdb_is_logined);
+    RESOLVE(handle, table, tsdb_charset_get);
+    RESOLVE(handle, table, tsdb_query);
+    RESOLVE(handle, table, tsdb_fetch_ml_fields);
+    RESOLVE(handle, table, tsdb_store_result_v2);
+    RESOLVE(handle, table, tsdb_free_result);
+    return 0;
+}
+
+// negotiate asks the library for the interface version the driver is built with.
+// The library answers with its own interface version, which must not be older
+// than TSDB_ML_VERSION_LOW.
+static int negotiate(void *handle, struct gortdb_tsdb_api *table, const char *path, char *err, int err_len)
+{
+    tsdb_ml_t *(*ml_new_s)(uint64_t version);
+    tsdb_ml_t *ml;
+
+    *(void **)(&ml_new_s) = dlsym(handle, "tsdb_ml_new_s");
+    if (ml_new_s == NULL)
+    {
+        snprintf(err, err_len, "%s: undefined symbol tsdb_ml_new_s, the library is older than interface version %llu",
+                 path, (unsigned long long)TSDB_ML_VERSION_LOW);
+        return -1;
+    }
+    ml = ml_new_s(TSDB_ML_VERSION);
+    if (ml == NULL)
+    {
+        snprintf(err, err_len, "%s: the library does not support interface version %llu",
+                 path, (unsigned long long)TSDB_ML_VERSION);
+        return -1;
+    }
+    table->version = ml->version;
+    snprintf(table->build_version, sizeof(table->build_version), "%s", ml->build_version != NULL ? ml->build_version : "");
+    if (ml->kill_me != NULL)
+    {
+        ml->kill_me(ml);
+    }
+    if (table->version < TSDB_ML_VERSION_LOW)
+    {
+        snprintf(err, err_len, "%s: interface version %llu of the library is older than the lowest supported version %llu",
+                 path, (unsigned long long)table->version, (unsigned long long)TSDB_ML_VERSION_LOW);
+        return -1;
+    }
+    return 0;
+}
+
+// negotiate_tls resolves the TLS client of the library, it is optional: tsdb_tls
+// is kept NULL when the library does not export tsdb_tls and tsdb_ml_tls_s, or
+// tsdb_ml_tls_s does not support the interface version of the driver.
+static void negotiate_tls(void *handle, struct gortdb_tsdb_api *table)
+{
+    tsdb_ml_t *(*ml_tls_s)(uint64_t version);
+    tsdb_ml_t *ml;
+
+    *(void **)(&table->tsdb_tls) = dlsym(handle, "tsdb_tls");
+    *(void **)(&ml_tls_s) = dlsym(handle, "tsdb_ml_tls_s");
+    if (table->tsdb_tls == NULL || ml_tls_s == NULL)
+    {
+        table->tsdb_tls = NULL;
+        return;
+    }
+    ml = ml_tls_s(TSDB_ML_VERSION);
+    if (ml == NULL || ml->version < TSDB_ML_VERSION_LOW)
+    {
+        table->tsdb_tls = NULL;
+    }
+    if (ml != NULL && ml->kill_me != NULL)
+    {
+        ml->kill_me(ml);
+    }
+}
+
+// open_library returns the handle of the library, NULL with GORTDB_EOPEN or
+// GORTDB_EVERSION in ret when it can not be used.
+static void *open_library(const char *path, struct gortdb_tsdb_api *table, char *err, int err_len, int *ret)
+{
+    void *handle = dlopen(path, RTLD_NOW | RTLD_LOCAL);
+    if (handle == NULL)
+    {
+        const char *reason = dlerror();
+        snprintf(err, err_len, "%s", reason != NULL ? reason : path);
+        *ret = GORTDB_EOPEN;
+        return NULL;
+    }
+    if (resolve(handle, table, path, err, err_len) != 0)
+    {
+        dlclose(handle);
+        *ret = GORTDB_EOPEN;
+        return NULL;
+    }
+    if (negotiate(handle, table, path, err, err_len) != 0)
+    {
+        dlclose(handle);
+        *ret = GORTDB_EVERSION;
+        return NULL;
+    }
+    negotiate_tls(handle, table);
+    *ret = 0;
+    return handle;
+}
+
+int gortdb_tsdb_load(const char *path, char *err, int err_len)
+{
+    struct gortdb_tsdb_api table;
+    void *handle;
+    int ret = 0;
+
+    memset(&table, 0, sizeof(table));
+    pthread_mutex_lock(&api_mutex);
+    if (api_handle == NULL)
+    {
+        handle = open_library(path, &table, err, err_len, &ret);
+        if (handle != NULL)
+        {
+            api = table;
+            api_handle = handle;
+        }
+    }
+    pthread_mutex_unlock(&api_mutex);
+    return ret;
+}
+
+int gortdb_tsdb_probe(const char *path, char *err, int err_len)
+{
+    struct gortdb_tsdb_api table;
+    int ret;
+    void *handle;
+
+    memset(&table, 0, sizeof(table));
+    handle = open_library(path, &table, err, err_len, &ret);
+    if (handle != NULL)
+    {
+        dlclose(handle);
+    }
+    return ret;
+}
+
+uint64_t gortdb_tsdb_version(const char **build_version)
+{
+    *build_version = api.build_version;
+    return api.version;
+}
+
+int gortdb_tsdb_tls_supported()
+{
+    return api.tsdb_tls != NULL;
+}
+
+tsdb_ml_t *gortdb_tsdb_new()
+{
+    return api.tsdb_new != NULL ? api.tsdb_new() : NULL;
+}
+
+void gortdb_tsdb_kill_me(void *self)
+{
+    if (api.tsdb_kill_me != NULL)
+    {
+        api.tsdb_kill_me(self);
+    }
+}
+
+int gortdb_tsdb_connect(const char *conn_str)
+{
+    return api.tsdb_connect != NULL ? api.tsdb_connect(conn_str) : GORTDB_ENOLIB;
+}
+
+int gortdb_tsdb_disconnect()
+{
+    return api.tsdb_disconnect != NULL ? api.tsdb_disconnect() : GORTDB_ENOLIB;
+}
+
+BOOL gortdb_tsdb_is_logined()
+{
+    return api.tsdb_is_logined != NULL ? api.tsdb_is_logined() : 0;
+}
+
+const char *gortdb_tsdb_charset_get()
+{
+    return api.tsdb_charset_get != NULL ? api.tsdb_charset_get() : NULL;
+}
+
+int gortdb_tsdb_query(void *self, const char *sql, int sql_len, const char *charset, const char *database)
+{
+    return api.tsdb_query != NULL ? api.tsdb_query(self, sql, sql_len, charset, database) : GORTDB_ENOLIB;
+}
+
+tsdb_ml_field_t **gortdb_tsdb_fetch_ml_fields(void *self, int *field_count)
+{
+    return api.tsdb_fetch_ml_fields != NULL ? api.tsdb_fetch_ml_fields(self, field_count) : NULL;
+}
+
+RTDB_RES_SET *gortdb_tsdb_store_result_v2(void *self)
+{
+    return api.tsdb_store_result_v2 != NULL ? api.tsdb_store_result_v2(self) : NULL;
+}
+
+int gortdb_tsdb_free_result(void *self, void *result)
+{
+    return api.tsdb_free_result != NULL ? api.tsdb_free_result(self, result) : GORTDB_ENOLIB;
+}
@@ -0,0 +1,43 @@
+#ifndef _gortdb_tsdb_dl_h_
+#define _gortdb_tsdb_dl_h_
+
+// libtsdb is opened at runtime with dlopen, the driver calls it through the
+// gortdb_tsdb_* functions below which forward to the resolved tsdb_* symbols.
+
+#include "tsdb_ml.h"
+
+// error codes of gortdb_tsdb_load and gortdb_tsdb_probe
+#define GORTDB_EOPEN (-1)    // the library can not be opened or misses symbols
+#define GORTDB_EVERSION (-2) // the interface version of the library is not supported
+
+#define GORTDB_BUILD_VERSION_LEN 128
+
+// gortdb_tsdb_load opens the library at path, resolves its symbols and negotiates
+// the interface version with tsdb_ml_new_s. It returns 0 on success, otherwise an
+// error code and the reason is written to err. The symbols of the first library
+// loaded successfully are kept, later calls do nothing.
+int gortdb_tsdb_load(const char *path, char *err, int err_len);
+
+// gortdb_tsdb_probe checks that path is a usable library without keeping it.
+int gortdb_tsdb_probe(const char *path, char *err, int err_len);
+
+// gortdb_tsdb_version returns the interface version and the build version of the
+// loaded library.
+uint64_t gortdb_tsdb_version(const char **build_version);
+
+// gortdb_tsdb_tls_supported reports whether the loaded library has a TLS client,
+// the optional tsdb_tls and tsdb_ml_tls_s symbols.
+int gortdb_tsdb_tls_supported();
+
+tsdb_ml_t *gortdb_tsdb_new();
+void gortdb_tsdb_kill_me(void *self);
+int gortdb_tsdb_connect(const char *conn_str);
+int gortdb_tsdb_disconnect();
+BOOL gortdb_tsdb_is_logined();
+const char *gortdb_tsdb_charset_get();
+int gortdb_tsdb_query(void *self, const char *sql, int sql_len, const char *charset, const char *database);
+tsdb_ml_field_t **gortdb_tsdb_fetch_ml_fields(void *self, int *field_count);
+RTDB_RES_SET *gortdb_tsdb_store_result_v2(void *self);
+int gortdb_tsdb_free_result(void *self, void *result);
+
+#endif
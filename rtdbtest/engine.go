@@ -0,0 +1,506 @@
+package rtdbtest
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/racetopdb/gortdb/rtdb"
+)
+
+// timeColumn is the implicit first column of every table.
+const timeColumn = "time"
+
+var timeLayouts = []string{
+	"2006-01-02 15:04:05.000",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+	time.RFC3339Nano,
+}
+
+// Engine is an in-memory rtdb server. It is safe for concurrent use by the
+// backends of several connections, which then share its databases.
+type Engine struct {
+	mu        sync.RWMutex
+	databases map[string]*database
+	// Now returns the time of the rows inserted without a time value, time.Now
+	// when it is nil.
+	Now func() time.Time
+}
+
+type database struct {
+	tables map[string]*table
+}
+
+type table struct {
+	fields []rtdb.Field
+	rows   [][]interface{} // ordered by time
+	last   time.Time       // time of the latest row
+}
+
+// resultSet is the result of a SELECT or SHOW statement.
+type resultSet struct {
+	fields []rtdb.Field
+	rows   [][]interface{}
+}
+
+// NewEngine returns an engine without databases.
+func NewEngine() *Engine {
+	return &Engine{databases: make(map[string]*database)}
+}
+
+// Reset drops all databases of the engine.
+func (e *Engine) Reset() {
+	e.mu.Lock()
+	e.databases = make(map[string]*database)
+	e.mu.Unlock()
+}
+
+func (e *Engine) now() time.Time {
+	if e.Now != nil {
+		return e.Now()
+	}
+	return time.Now()
+}
+
+// session is the state of one connection to the engine.
+type session struct {
+	engine *Engine
+	db     string // database selected by USE, or of the DSN
+	loc    *time.Location
+}
+
+// exec executes the statements of query and returns the result of the last one
+// and the number of rows written.
+func (s *session) exec(query string) (*resultSet, uint64, error) {
+	stmts, err := parse(query)
+	if err != nil {
+		return nil, 0, err
+	}
+	var (
+		result   *resultSet
+		affected uint64
+	)
+	for _, stmt := range stmts {
+		var n uint64
+		if result, n, err = s.execStmt(stmt); err != nil {
+			return nil, 0, err
+		}
+		affected += n
+	}
+	return result, affected, nil
+}
+
+func (s *session) execStmt(stmt interface{}) (*resultSet, uint64, error) {
+	e := s.engine
+	switch stmt := stmt.(type) {
+	case *selectStmt:
+		e.mu.RLock()
+		defer e.mu.RUnlock()
+		result, err := s.selectRows(stmt)
+		return result, 0, err
+	case *showDatabasesStmt:
+		e.mu.RLock()
+		defer e.mu.RUnlock()
+		return showNames("database", e.databases), 0, nil
+	case *showTablesStmt:
+		e.mu.RLock()
+		defer e.mu.RUnlock()
+		db, err := s.database()
+		if err != nil {
+			return nil, 0, err
+		}
+		return showNames("table", db.tables), 0, nil
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	switch stmt := stmt.(type) {
+	case *createDatabaseStmt:
+		if _, ok := e.databases[stmt.name]; ok {
+			if stmt.ifNotExists {
+				return nil, 0, nil
+			}
+			return nil, 0, fmt.Errorf("rtdbtest: database %q already exists: %w", stmt.name, rtdb.InvalidArgs)
+		}
+		e.databases[stmt.name] = &database{tables: make(map[string]*table)}
+	case *useStmt:
+		if _, ok := e.databases[stmt.name]; !ok {
+			return nil, 0, fmt.Errorf("rtdbtest: unknown database %q: %w", stmt.name, rtdb.InvalidArgs)
+		}
+		s.db = stmt.name
+	case *createTableStmt:
+		return nil, 0, s.createTable(stmt)
+	case *insertStmt:
+		n, err := s.insert(stmt)
+		return nil, n, err
+	}
+	return nil, 0, nil
+}
+
+// showNames returns the sorted keys of m as a result set of one column.
+func showNames(column string, m interface{}) *resultSet {
+	var names []string
+	switch m := m.(type) {
+	case map[string]*database:
+		for name := range m {
+			names = append(names, name)
+		}
+	case map[string]*table:
+		for name := range m {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	result := &resultSet{fields: []rtdb.Field{{Name: column, Type: rtdb.FieldTypeString}}}
+	for _, name := range names {
+		result.rows = append(result.rows, []interface{}{name})
+	}
+	return result
+}
+
+func (s *session) database() (*database, error) {
+	if s.db == "" {
+		return nil, fmt.Errorf("rtdbtest: no database selected: %w", rtdb.InvalidArgs)
+	}
+	db, ok := s.engine.databases[s.db]
+	if !ok {
+		return nil, fmt.Errorf("rtdbtest: unknown database %q: %w", s.db, rtdb.InvalidArgs)
+	}
+	return db, nil
+}
+
+func (s *session) table(name string) (*table, error) {
+	db, err := s.database()
+	if err != nil {
+		return nil, err
+	}
+	t, ok := db.tables[name]
+	if !ok {
+		return nil, fmt.Errorf("rtdbtest: unknown table %q: %w", name, rtdb.InvalidArgs)
+	}
+	return t, nil
+}
+
+func (s *session) createTable(stmt *createTableStmt) error {
+	db, err := s.database()
+	if err != nil {
+		return err
+	}
+	if _, ok := db.tables[stmt.name]; ok {
+		if stmt.ifNotExists {
+			return nil
+		}
+		return fmt.Errorf("rtdbtest: table %q already exists: %w", stmt.name, rtdb.InvalidArgs)
+	}
+	t := &table{fields: []rtdb.Field{{Name: timeColumn, Type: rtdb.FieldTypeDatetime}}}
+	for _, column := range stmt.columns {
+		if t.column(column.name) >= 0 {
+			return fmt.Errorf("rtdbtest: duplicate column %q: %w", column.name, rtdb.InvalidArgs)
+		}
+		t.fields = append(t.fields, rtdb.Field{
+			Name:     column.name,
+			Length:   uint8(column.length),
+			Type:     column.fieldType,
+			Nullable: true,
+		})
+	}
+	db.tables[stmt.name] = t
+	return nil
+}
+
+// column returns the index of the column name, -1 when there is none.
+func (t *table) column(name string) int {
+	for i, f := range t.fields {
+		if strings.EqualFold(f.Name, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (t *table) columns(names []string) ([]int, error) {
+	if names == nil {
+		indexes := make([]int, len(t.fields))
+		for i := range indexes {
+			indexes[i] = i
+		}
+		return indexes, nil
+	}
+	indexes := make([]int, len(names))
+	for i, name := range names {
+		if indexes[i] = t.column(name); indexes[i] < 0 {
+			return nil, fmt.Errorf("rtdbtest: unknown column %q: %w", name, rtdb.InvalidArgs)
+		}
+	}
+	return indexes, nil
+}
+
+func (s *session) insert(stmt *insertStmt) (uint64, error) {
+	t, err := s.table(stmt.table)
+	if err != nil {
+		return 0, err
+	}
+	names := stmt.columns
+	if names == nil {
+		// without a column list the values are given for the declared columns
+		for _, f := range t.fields[1:] {
+			names = append(names, f.Name)
+		}
+	}
+	indexes, err := t.columns(names)
+	if err != nil {
+		return 0, err
+	}
+	rows := make([][]interface{}, 0, len(stmt.rows))
+	for _, values := range stmt.rows {
+		if len(values) != len(indexes) {
+			return 0, fmt.Errorf("rtdbtest: %d values for %d columns: %w", len(values), len(indexes), rtdb.InvalidArgs)
+		}
+		row := make([]interface{}, len(t.fields))
+		for i, index := range indexes {
+			if row[index], err = convert(t.fields[index], values[i], s.loc); err != nil {
+				return 0, err
+			}
+		}
+		rows = append(rows, row)
+	}
+	// all values are valid, store the rows
+	for _, row := range rows {
+		if row[0] == nil {
+			at := s.engine.now().UTC().Truncate(time.Millisecond)
+			// rows are identified by their time, keep the generated ones apart
+			if !at.After(t.last) {
+				at = t.last.Add(time.Millisecond)
+			}
+			row[0] = at
+		}
+		t.add(row)
+	}
+	return uint64(len(rows)), nil
+}
+
+func (t *table) add(row []interface{}) {
+	at := row[0].(time.Time)
+	i := sort.Search(len(t.rows), func(i int) bool {
+		return t.rows[i][0].(time.Time).After(at)
+	})
+	t.rows = append(t.rows, nil)
+	copy(t.rows[i+1:], t.rows[i:])
+	t.rows[i] = row
+	if at.After(t.last) {
+		t.last = at
+	}
+}
+
+func (s *session) selectRows(stmt *selectStmt) (*resultSet, error) {
+	t, err := s.table(stmt.table)
+	if err != nil {
+		return nil, err
+	}
+	indexes, err := t.columns(stmt.columns)
+	if err != nil {
+		return nil, err
+	}
+	filter, err := s.filter(t, stmt.where)
+	if err != nil {
+		return nil, err
+	}
+	result := &resultSet{}
+	for _, index := range indexes {
+		result.fields = append(result.fields, t.fields[index])
+	}
+	for _, row := range t.rows {
+		if !filter(row) {
+			continue
+		}
+		values := make([]interface{}, len(indexes))
+		for i, index := range indexes {
+			values[i] = row[index]
+			if b, ok := values[i].([]byte); ok {
+				values[i] = append([]byte(nil), b...)
+			}
+		}
+		result.rows = append(result.rows, values)
+	}
+	if stmt.last && len(result.rows) > 1 {
+		result.rows = result.rows[len(result.rows)-1:]
+	}
+	return result, nil
+}
+
+// filter converts the conditions of a WHERE clause into a predicate on the rows of t.
+func (s *session) filter(t *table, where []condition) (func(row []interface{}) bool, error) {
+	type predicate struct {
+		index  int
+		op     string
+		values []interface{}
+	}
+	predicates := make([]predicate, 0, len(where))
+	for _, cond := range where {
+		index := t.column(cond.column)
+		if index < 0 {
+			return nil, fmt.Errorf("rtdbtest: unknown column %q: %w", cond.column, rtdb.InvalidArgs)
+		}
+		p := predicate{index: index, op: cond.op}
+		for _, l := range cond.values {
+			v, err := convert(t.fields[index], l, s.loc)
+			if err != nil {
+				return nil, err
+			}
+			p.values = append(p.values, v)
+		}
+		predicates = append(predicates, p)
+	}
+	return func(row []interface{}) bool {
+		for _, p := range predicates {
+			c, ok := compare(row[p.index], p.values[0])
+			if !ok {
+				return false
+			}
+			switch p.op {
+			case "=":
+				ok = c == 0
+			case "!=", "<>":
+				ok = c != 0
+			case "<":
+				ok = c < 0
+			case "<=":
+				ok = c <= 0
+			case ">":
+				ok = c > 0
+			case ">=", "BETWEEN":
+				ok = c >= 0
+			}
+			if ok && p.op == "BETWEEN" {
+				c, ok = compare(row[p.index], p.values[1])
+				ok = ok && c <= 0
+			}
+			if !ok {
+				return false
+			}
+		}
+		return true
+	}, nil
+}
+
+// convert converts a literal into a value of the type of field, the values have
+// the types returned by the cgo adapter. Datetime literals are read in loc.
+func convert(field rtdb.Field, l literal, loc *time.Location) (interface{}, error) {
+	if l.isNull() {
+		return nil, nil
+	}
+	invalid := func() error {
+		return fmt.Errorf("rtdbtest: invalid value %q for column %q: %w", l.text, field.Name, rtdb.InvalidArgs)
+	}
+	if l.kind == tokenHex && field.Type != rtdb.FieldTypeBinary {
+		return nil, invalid()
+	}
+	switch field.Type {
+	case rtdb.FieldTypeBool:
+		switch strings.ToLower(l.text) {
+		case "true", "1":
+			return true, nil
+		case "false", "0":
+			return false, nil
+		}
+	case rtdb.FieldTypeInt:
+		if v, err := strconv.ParseInt(l.text, 10, 32); err == nil {
+			return int32(v), nil
+		}
+	case rtdb.FieldTypeInt64:
+		if v, err := strconv.ParseInt(l.text, 10, 64); err == nil {
+			return v, nil
+		}
+	case rtdb.FieldTypeFloat:
+		if v, err := strconv.ParseFloat(l.text, 32); err == nil {
+			return float32(v), nil
+		}
+	case rtdb.FieldTypeDouble:
+		if v, err := strconv.ParseFloat(l.text, 64); err == nil {
+			return v, nil
+		}
+	case rtdb.FieldTypeString:
+		if l.kind == tokenQuoted || l.kind == tokenNumber {
+			return l.text, nil
+		}
+	case rtdb.FieldTypeBinary:
+		if l.kind == tokenHex {
+			if v, err := hex.DecodeString(l.text); err == nil {
+				return v, nil
+			}
+		} else if l.kind == tokenQuoted {
+			return []byte(l.text), nil
+		}
+	case rtdb.FieldTypeDatetime:
+		if l.kind == tokenNumber {
+			if ms, err := strconv.ParseInt(l.text, 10, 64); err == nil {
+				return time.Unix(ms/1000, (ms%1000)*int64(time.Millisecond)).UTC(), nil
+			}
+			break
+		}
+		for _, layout := range timeLayouts {
+			if t, err := time.ParseInLocation(layout, l.text, loc); err == nil {
+				return t.UTC().Truncate(time.Millisecond), nil
+			}
+		}
+	}
+	return nil, invalid()
+}
+
+// compare compares two values of the same column, false when one of them is NULL.
+func compare(a, b interface{}) (int, bool) {
+	if a == nil || b == nil {
+		return 0, false
+	}
+	switch a := a.(type) {
+	case bool:
+		if a == b.(bool) {
+			return 0, true
+		}
+		if a {
+			return 1, true
+		}
+		return -1, true
+	case int32:
+		return compareInt(int64(a), int64(b.(int32))), true
+	case int64:
+		return compareInt(a, b.(int64)), true
+	case float32:
+		return compareFloat(float64(a), float64(b.(float32))), true
+	case float64:
+		return compareFloat(a, b.(float64)), true
+	case string:
+		return strings.Compare(a, b.(string)), true
+	case []byte:
+		return bytes.Compare(a, b.([]byte)), true
+	case time.Time:
+		return compareInt(a.UnixNano(), b.(time.Time).UnixNano()), true
+	}
+	return 0, false
+}
+
+func compareInt(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func compareFloat(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
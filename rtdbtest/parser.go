@@ -0,0 +1,563 @@
+package rtdbtest
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/racetopdb/gortdb/rtdb"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF    tokenKind = iota
+	tokenIdent            // bare word
+	tokenQuoted           // '...', "..." or `...`, names or strings depending on the position
+	tokenNumber           // integer or decimal number
+	tokenHex              // binary literal, X'0a1b'
+	tokenSymbol           // ( ) , ; * - = != <> < <= > >=
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+func syntaxError(format string, args ...interface{}) error {
+	return fmt.Errorf("rtdbtest: "+format+": %w", append(args, rtdb.InvalidArgs)...)
+}
+
+// tokenize splits query into tokens, quoted text is unescaped.
+func tokenize(query string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case (c == 'x' || c == 'X') && i+1 < len(query) && query[i+1] == '\'':
+			end := strings.IndexByte(query[i+2:], '\'')
+			if end < 0 {
+				return nil, syntaxError("unterminated binary literal at %d", i)
+			}
+			tokens = append(tokens, token{tokenHex, query[i+2 : i+2+end]})
+			i += end + 3
+		case isLetter(c):
+			j := i + 1
+			for j < len(query) && (isLetter(query[j]) || isDigit(query[j])) {
+				j++
+			}
+			tokens = append(tokens, token{tokenIdent, query[i:j]})
+			i = j
+		case isDigit(c) || c == '.' && i+1 < len(query) && isDigit(query[i+1]):
+			j := i + 1
+			for j < len(query) && (isDigit(query[j]) || query[j] == '.') {
+				j++
+			}
+			if j < len(query) && (query[j] == 'e' || query[j] == 'E') {
+				j++
+				if j < len(query) && (query[j] == '+' || query[j] == '-') {
+					j++
+				}
+				for j < len(query) && isDigit(query[j]) {
+					j++
+				}
+			}
+			tokens = append(tokens, token{tokenNumber, query[i:j]})
+			i = j
+		case c == '\'' || c == '"' || c == '`':
+			text, n, err := unquote(query[i:])
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{tokenQuoted, text})
+			i += n
+		case c == '!' || c == '<' || c == '>':
+			if i+1 < len(query) && (query[i+1] == '=' || c == '<' && query[i+1] == '>') {
+				tokens = append(tokens, token{tokenSymbol, query[i : i+2]})
+				i += 2
+				continue
+			}
+			if c == '!' {
+				return nil, syntaxError("unexpected %q at %d", c, i)
+			}
+			tokens = append(tokens, token{tokenSymbol, query[i : i+1]})
+			i++
+		case strings.IndexByte("(),;*-=", c) >= 0:
+			tokens = append(tokens, token{tokenSymbol, query[i : i+1]})
+			i++
+		default:
+			return nil, syntaxError("unexpected %q at %d", c, i)
+		}
+	}
+	return tokens, nil
+}
+
+// unquote returns the text of the quoted string at the start of s and the length
+// of its source. Quotes are escaped with a backslash or doubled.
+func unquote(s string) (string, int, error) {
+	quote := s[0]
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if i+1 < len(s) {
+				i++
+			}
+			b.WriteByte(s[i])
+		case quote:
+			if i+1 < len(s) && s[i+1] == quote {
+				b.WriteByte(quote)
+				i++
+				continue
+			}
+			return b.String(), i + 1, nil
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return "", 0, syntaxError("unterminated quoted string")
+}
+
+func isLetter(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// literal is a value of a statement.
+type literal struct {
+	kind tokenKind // tokenQuoted, tokenNumber, tokenHex or tokenIdent for NULL, TRUE and FALSE
+	text string
+}
+
+func (l literal) isNull() bool {
+	return l.kind == tokenIdent && strings.EqualFold(l.text, "NULL")
+}
+
+// columnDef is a column of CREATE TABLE.
+type columnDef struct {
+	name      string
+	fieldType rtdb.FieldType
+	length    int
+}
+
+// condition is one predicate of a WHERE clause, the predicates are joined by AND.
+type condition struct {
+	column string
+	op     string // = != <> < <= > >= or BETWEEN
+	values []literal
+}
+
+type (
+	createDatabaseStmt struct {
+		name        string
+		ifNotExists bool
+	}
+	createTableStmt struct {
+		name        string
+		ifNotExists bool
+		columns     []columnDef
+	}
+	useStmt struct {
+		name string
+	}
+	insertStmt struct {
+		table   string
+		columns []string // nil when the statement has no column list
+		rows    [][]literal
+	}
+	selectStmt struct {
+		table   string
+		last    bool
+		columns []string // nil for *
+		where   []condition
+	}
+	showDatabasesStmt struct{}
+	showTablesStmt    struct{}
+)
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+// parse splits query into statements on ';' and parses them.
+func parse(query string) ([]interface{}, error) {
+	tokens, err := tokenize(query)
+	if err != nil {
+		return nil, err
+	}
+	var stmts []interface{}
+	start := 0
+	for i := 0; i <= len(tokens); i++ {
+		if i < len(tokens) && !(tokens[i].kind == tokenSymbol && tokens[i].text == ";") {
+			continue
+		}
+		if i > start {
+			p := &parser{tokens: tokens[start:i]}
+			stmt, err := p.statement()
+			if err != nil {
+				return nil, err
+			}
+			stmts = append(stmts, stmt)
+		}
+		start = i + 1
+	}
+	if len(stmts) == 0 {
+		return nil, syntaxError("empty query")
+	}
+	return stmts, nil
+}
+
+func (p *parser) peek() token {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return token{kind: tokenEOF}
+}
+
+func (p *parser) next() token {
+	t := p.peek()
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+// keyword consumes words when the next tokens are these keywords.
+func (p *parser) keyword(words ...string) bool {
+	for i, w := range words {
+		if p.pos+i >= len(p.tokens) {
+			return false
+		}
+		t := p.tokens[p.pos+i]
+		if t.kind != tokenIdent || !strings.EqualFold(t.text, w) {
+			return false
+		}
+	}
+	p.pos += len(words)
+	return true
+}
+
+func (p *parser) expectKeyword(words ...string) error {
+	if !p.keyword(words...) {
+		return p.unexpected(strings.Join(words, " "))
+	}
+	return nil
+}
+
+func (p *parser) symbol(s string) bool {
+	if t := p.peek(); t.kind == tokenSymbol && t.text == s {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expectSymbol(s string) error {
+	if !p.symbol(s) {
+		return p.unexpected(fmt.Sprintf("%q", s))
+	}
+	return nil
+}
+
+func (p *parser) unexpected(want string) error {
+	t := p.peek()
+	if t.kind == tokenEOF {
+		return syntaxError("expected %s at end of statement", want)
+	}
+	return syntaxError("expected %s near %q", want, t.text)
+}
+
+// name reads a database, table or column name, bare or quoted.
+func (p *parser) name() (string, error) {
+	if t := p.peek(); t.kind == tokenIdent || t.kind == tokenQuoted && t.text != "" {
+		p.pos++
+		return t.text, nil
+	}
+	return "", p.unexpected("name")
+}
+
+func (p *parser) names() ([]string, error) {
+	var names []string
+	for {
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+		if !p.symbol(",") {
+			return names, nil
+		}
+	}
+}
+
+func (p *parser) literal() (literal, error) {
+	start := p.pos
+	negative := p.symbol("-")
+	t := p.peek()
+	switch {
+	case t.kind == tokenNumber:
+		p.pos++
+		if negative {
+			t.text = "-" + t.text
+		}
+		return literal{tokenNumber, t.text}, nil
+	case negative:
+	case t.kind == tokenQuoted || t.kind == tokenHex:
+		p.pos++
+		return literal{t.kind, t.text}, nil
+	case t.kind == tokenIdent && isConstant(t.text):
+		p.pos++
+		return literal{tokenIdent, t.text}, nil
+	}
+	p.pos = start
+	return literal{}, p.unexpected("value")
+}
+
+func isConstant(word string) bool {
+	switch strings.ToUpper(word) {
+	case "NULL", "TRUE", "FALSE":
+		return true
+	}
+	return false
+}
+
+func (p *parser) end(stmt interface{}) (interface{}, error) {
+	if p.peek().kind != tokenEOF {
+		return nil, p.unexpected("end of statement")
+	}
+	return stmt, nil
+}
+
+func (p *parser) statement() (interface{}, error) {
+	switch {
+	case p.keyword("CREATE", "DATABASE"):
+		return p.createDatabase()
+	case p.keyword("CREATE", "TABLE"):
+		return p.createTable()
+	case p.keyword("USE"):
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		return p.end(&useStmt{name: name})
+	case p.keyword("INSERT", "INTO"):
+		return p.insert()
+	case p.keyword("SELECT"):
+		return p.selectFrom()
+	case p.keyword("SHOW", "DATABASES"):
+		return p.end(&showDatabasesStmt{})
+	case p.keyword("SHOW", "TABLES"):
+		return p.end(&showTablesStmt{})
+	}
+	return nil, syntaxError("unsupported statement near %q", p.peek().text)
+}
+
+// createDatabase parses "CREATE DATABASE [IF NOT EXISTS] name [IF NOT EXISTS]".
+func (p *parser) createDatabase() (interface{}, error) {
+	stmt := &createDatabaseStmt{ifNotExists: p.keyword("IF", "NOT", "EXISTS")}
+	name, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	stmt.name = name
+	if p.keyword("IF", "NOT", "EXISTS") {
+		stmt.ifNotExists = true
+	}
+	return p.end(stmt)
+}
+
+// createTable parses "CREATE TABLE [IF NOT EXISTS] name [IF NOT EXISTS] (column type, ...)".
+func (p *parser) createTable() (interface{}, error) {
+	stmt := &createTableStmt{ifNotExists: p.keyword("IF", "NOT", "EXISTS")}
+	name, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	stmt.name = name
+	if p.keyword("IF", "NOT", "EXISTS") {
+		stmt.ifNotExists = true
+	}
+	if err := p.expectSymbol("("); err != nil {
+		return nil, err
+	}
+	for {
+		column, err := p.columnDef()
+		if err != nil {
+			return nil, err
+		}
+		stmt.columns = append(stmt.columns, column)
+		if p.symbol(")") {
+			break
+		}
+		if err := p.expectSymbol(","); err != nil {
+			return nil, err
+		}
+	}
+	return p.end(stmt)
+}
+
+var columnTypes = map[string]rtdb.FieldType{
+	"BOOL":      rtdb.FieldTypeBool,
+	"BOOLEAN":   rtdb.FieldTypeBool,
+	"TINYINT":   rtdb.FieldTypeInt,
+	"SMALLINT":  rtdb.FieldTypeInt,
+	"INT":       rtdb.FieldTypeInt,
+	"INTEGER":   rtdb.FieldTypeInt,
+	"BIGINT":    rtdb.FieldTypeInt64,
+	"INT64":     rtdb.FieldTypeInt64,
+	"FLOAT":     rtdb.FieldTypeFloat,
+	"REAL":      rtdb.FieldTypeFloat,
+	"DOUBLE":    rtdb.FieldTypeDouble,
+	"BINARY":    rtdb.FieldTypeBinary,
+	"VARBINARY": rtdb.FieldTypeBinary,
+	"BLOB":      rtdb.FieldTypeBinary,
+	"CHAR":      rtdb.FieldTypeString,
+	"VARCHAR":   rtdb.FieldTypeString,
+	"NCHAR":     rtdb.FieldTypeString,
+	"STRING":    rtdb.FieldTypeString,
+	"TEXT":      rtdb.FieldTypeString,
+	"DATETIME":  rtdb.FieldTypeDatetime,
+	"TIMESTAMP": rtdb.FieldTypeDatetime,
+}
+
+func (p *parser) columnDef() (columnDef, error) {
+	name, err := p.name()
+	if err != nil {
+		return columnDef{}, err
+	}
+	t := p.next()
+	fieldType, ok := columnTypes[strings.ToUpper(t.text)]
+	if t.kind != tokenIdent || !ok {
+		return columnDef{}, syntaxError("unknown type %q of column %q", t.text, name)
+	}
+	column := columnDef{name: name, fieldType: fieldType}
+	if p.symbol("(") {
+		n := p.next()
+		if n.kind != tokenNumber {
+			return columnDef{}, syntaxError("invalid length of column %q", name)
+		}
+		fmt.Sscan(n.text, &column.length)
+		if err := p.expectSymbol(")"); err != nil {
+			return columnDef{}, err
+		}
+	}
+	return column, nil
+}
+
+// insert parses "INSERT INTO name [(column, ...)] VALUES (value, ...) [, (value, ...)]".
+func (p *parser) insert() (interface{}, error) {
+	table, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	stmt := &insertStmt{table: table}
+	if p.symbol("(") {
+		if stmt.columns, err = p.names(); err != nil {
+			return nil, err
+		}
+		if err := p.expectSymbol(")"); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.expectKeyword("VALUES"); err != nil {
+		return nil, err
+	}
+	for {
+		if err := p.expectSymbol("("); err != nil {
+			return nil, err
+		}
+		var row []literal
+		for {
+			value, err := p.literal()
+			if err != nil {
+				return nil, err
+			}
+			row = append(row, value)
+			if p.symbol(")") {
+				break
+			}
+			if err := p.expectSymbol(","); err != nil {
+				return nil, err
+			}
+		}
+		stmt.rows = append(stmt.rows, row)
+		if !p.symbol(",") {
+			break
+		}
+	}
+	return p.end(stmt)
+}
+
+// selectFrom parses "SELECT [LAST] * | column, ... FROM name [WHERE condition AND ...]".
+func (p *parser) selectFrom() (interface{}, error) {
+	stmt := &selectStmt{last: p.keyword("LAST")}
+	if !p.symbol("*") {
+		columns, err := p.names()
+		if err != nil {
+			return nil, err
+		}
+		stmt.columns = columns
+	}
+	if err := p.expectKeyword("FROM"); err != nil {
+		return nil, err
+	}
+	table, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	stmt.table = table
+	if p.keyword("WHERE") {
+		for {
+			cond, err := p.condition()
+			if err != nil {
+				return nil, err
+			}
+			stmt.where = append(stmt.where, cond)
+			if !p.keyword("AND") {
+				break
+			}
+		}
+	}
+	return p.end(stmt)
+}
+
+func (p *parser) condition() (condition, error) {
+	column, err := p.name()
+	if err != nil {
+		return condition{}, err
+	}
+	cond := condition{column: column}
+	if p.keyword("BETWEEN") {
+		from, err := p.literal()
+		if err != nil {
+			return condition{}, err
+		}
+		if err := p.expectKeyword("AND"); err != nil {
+			return condition{}, err
+		}
+		to, err := p.literal()
+		if err != nil {
+			return condition{}, err
+		}
+		cond.op, cond.values = "BETWEEN", []literal{from, to}
+		return cond, nil
+	}
+	if t := p.peek(); t.kind == tokenSymbol {
+		switch t.text {
+		case "=", "!=", "<>", "<", "<=", ">", ">=":
+			p.pos++
+			value, err := p.literal()
+			if err != nil {
+				return condition{}, err
+			}
+			cond.op, cond.values = t.text, []literal{value}
+			return cond, nil
+		}
+	}
+	return condition{}, p.unexpected("operator")
+}
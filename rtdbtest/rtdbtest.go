@@ -0,0 +1,182 @@
+// Package rtdbtest provides an in-memory rtdb server for tests which run without
+// libtsdb.so and without a network.
+//
+// Importing the package registers the "rtdbtest" database/sql driver, which accepts
+// the DSN of the rtdb driver. All connections to the same address share one Engine:
+//
+//	db, err := sql.Open("rtdbtest", "test:test@tcp(127.0.0.1:9000)/test_db")
+//
+// It also registers the "rtdbtest" backend of the rtdb driver, selected with the
+// backend DSN parameter, or used by default when the driver is built without cgo:
+//
+//	db, err := sql.Open("rtdb", "test:test@tcp(127.0.0.1:9000)/test_db?backend=rtdbtest")
+//
+// The engine understands the dialect used by the examples: CREATE DATABASE,
+// USE, CREATE TABLE with the implicit time column, INSERT, SELECT [LAST] with
+// "WHERE time BETWEEN ... AND ..." and other comparisons joined by AND, SHOW
+// DATABASES and SHOW TABLES.
+package rtdbtest
+
+import (
+	"database/sql"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/racetopdb/gortdb/rtdb"
+)
+
+// DriverName is the name of the registered database/sql driver.
+const DriverName = "rtdbtest"
+
+var (
+	enginesMu sync.Mutex
+	engines   = make(map[string]*Engine)
+)
+
+func init() {
+	sql.Register(DriverName, Driver())
+	rtdb.RegisterBackend(DriverName, sharedBackend)
+}
+
+// Driver returns an rtdb driver whose connections use the shared engine of their address.
+func Driver() *rtdb.RtdbDriver {
+	return rtdb.NewDriver(rtdb.WithBackend(sharedBackend))
+}
+
+func sharedBackend(cfg *rtdb.Config) (rtdb.Backend, error) {
+	return Shared(cfg.Address).NewBackend(cfg)
+}
+
+// Shared returns the engine of the registered driver for address, creating it
+// on first use.
+func Shared(address string) *Engine {
+	enginesMu.Lock()
+	defer enginesMu.Unlock()
+	e, ok := engines[address]
+	if !ok {
+		e = NewEngine()
+		engines[address] = e
+	}
+	return e
+}
+
+// Driver returns an rtdb driver whose connections use e.
+func (e *Engine) Driver() *rtdb.RtdbDriver {
+	return rtdb.NewDriver(rtdb.WithBackend(e.NewBackend))
+}
+
+// NewBackend returns a backend connected to e, it is a rtdb.BackendFactory.
+func (e *Engine) NewBackend(cfg *rtdb.Config) (rtdb.Backend, error) {
+	loc := cfg.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	return &backend{
+		session:  session{engine: e, db: cfg.DBName, loc: loc},
+		password: cfg.Password,
+	}, nil
+}
+
+// backend implements rtdb.Backend on an engine.
+type backend struct {
+	session
+	password string
+	logined  bool
+	cleaned  bool
+
+	pending  *resultSet // result of the last Query, until StoreResult
+	written  uint64
+	result   *resultSet
+	affected uint64
+	cursor   int
+}
+
+func (b *backend) Connect() error {
+	if b.cleaned {
+		return rtdb.InvalidConn
+	}
+	// like libtsdb, an empty password is rejected
+	if b.password == "" {
+		return rtdb.InvalidArgs
+	}
+	b.logined = true
+	return nil
+}
+
+func (b *backend) Disconnect() error {
+	b.logined = false
+	return nil
+}
+
+func (b *backend) IsLogined() bool {
+	return b.logined
+}
+
+// Valid implements rtdb.Validator, the emulator has no link which may break.
+func (b *backend) Valid() bool {
+	return b.logined
+}
+
+func (b *backend) Query(sql string, charset string, db string) error {
+	if !b.logined {
+		return rtdb.InvalidConn
+	}
+	if b.session.db == "" {
+		b.session.db = db
+	}
+	result, written, err := b.session.exec(sql)
+	if err != nil {
+		return err
+	}
+	b.pending, b.written = result, written
+	return nil
+}
+
+func (b *backend) StoreResult() error {
+	b.result, b.affected, b.cursor = b.pending, b.written, 0
+	b.pending, b.written = nil, 0
+	if b.result != nil {
+		b.affected = uint64(len(b.result.rows))
+	}
+	return nil
+}
+
+func (b *backend) IsResultSetEmpty() bool {
+	return b.result == nil
+}
+
+func (b *backend) AffectedRows() uint64 {
+	return b.affected
+}
+
+func (b *backend) FetchFields() []rtdb.Field {
+	if b.result == nil {
+		return nil
+	}
+	return append([]rtdb.Field(nil), b.result.fields...)
+}
+
+func (b *backend) FetchOne() ([]interface{}, error) {
+	if b.ReadDone() {
+		return nil, io.EOF
+	}
+	row := b.result.rows[b.cursor]
+	b.cursor++
+	return row, nil
+}
+
+func (b *backend) ReadDone() bool {
+	return b.result == nil || b.cursor >= len(b.result.rows)
+}
+
+func (b *backend) FreeResult() error {
+	b.result, b.affected, b.cursor = nil, 0, 0
+	return nil
+}
+
+func (b *backend) CleanUp() error {
+	b.cleaned, b.logined = true, false
+	b.pending, b.result = nil, nil
+	return nil
+}
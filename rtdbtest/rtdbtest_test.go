@@ -0,0 +1,246 @@
+package rtdbtest
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/racetopdb/gortdb/rtdb"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// go test -timeout 30s -run ^Test_parse$ github.com/racetopdb/gortdb/rtdbtest -v
+func Test_parse(t *testing.T) {
+	Convey("Test_parse", t, func(ctx C) {
+		Convey("Statements of the examples should be parsed", func(ctx C) {
+			stmts, err := parse("CREATE DATABASE 'test_db' IF NOT EXISTS;\nUSE 'test_db';")
+			So(err, ShouldBeNil)
+			So(stmts, ShouldResemble, []interface{}{
+				&createDatabaseStmt{name: "test_db", ifNotExists: true},
+				&useStmt{name: "test_db"},
+			})
+
+			stmts, err = parse("CREATE TABLE IF NOT EXISTS 'transcipt'(id int, student_name char(100))")
+			So(err, ShouldBeNil)
+			So(stmts[0], ShouldResemble, &createTableStmt{name: "transcipt", ifNotExists: true, columns: []columnDef{
+				{name: "id", fieldType: rtdb.FieldTypeInt},
+				{name: "student_name", fieldType: rtdb.FieldTypeString, length: 100},
+			}})
+
+			stmts, err = parse("select * from transcipt where time between '2021-01-01 00:00:00.000' and '2021-01-02 00:00:00.000' and student_name = 'it''s'")
+			So(err, ShouldBeNil)
+			So(stmts[0], ShouldResemble, &selectStmt{table: "transcipt", where: []condition{
+				{column: "time", op: "BETWEEN", values: []literal{{tokenQuoted, "2021-01-01 00:00:00.000"}, {tokenQuoted, "2021-01-02 00:00:00.000"}}},
+				{column: "student_name", op: "=", values: []literal{{tokenQuoted, "it's"}}},
+			}})
+		})
+
+		Convey("Invalid statements should return rtdb.InvalidArgs", func(ctx C) {
+			for _, query := range []string{
+				"",
+				"DROP TABLE t",
+				"SELECT * FROM",
+				"INSERT INTO t VALUES(1, 'a)",
+				"SELECT * FROM t WHERE id ! 1",
+			} {
+				_, err := parse(query)
+				So(errors.Is(err, rtdb.InvalidArgs), ShouldBeTrue)
+			}
+		})
+	})
+}
+
+// go test -timeout 30s -run ^TestEngine$ github.com/racetopdb/gortdb/rtdbtest -v
+func TestEngine(t *testing.T) {
+	Convey("TestEngine", t, func(ctx C) {
+		e := NewEngine()
+		start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+		now := start
+		e.Now = func() time.Time { return now }
+		db := sql.OpenDB(mustConnector(e.Driver(), "test:test@tcp(127.0.0.1:9000)/test_db?loc=UTC"))
+		defer db.Close()
+
+		mustExec := func(query string, args ...interface{}) {
+			_, err := db.Exec(query, args...)
+			So(err, ShouldBeNil)
+		}
+		mustExec("CREATE DATABASE 'test_db' IF NOT EXISTS;")
+		mustExec("USE 'test_db';")
+		mustExec("CREATE TABLE IF NOT EXISTS 'transcipt'(id int, student_name char(100), score double, frame binary(8))")
+		for i := 0; i < 10; i++ {
+			now = start.Add(time.Duration(i) * time.Minute)
+			// []byte arguments are not bound, binary values are written as literals
+			mustExec(fmt.Sprintf("INSERT INTO 'transcipt'(id, student_name, score, frame) VALUES(?, ?, ?, X'%02x')", i), i, fmt.Sprintf("s%d", i%3), float64(i)*1.5)
+		}
+
+		Convey("SHOW DATABASES should list the created database", func(ctx C) {
+			var name string
+			So(db.QueryRow("SHOW DATABASES;").Scan(&name), ShouldBeNil)
+			So(name, ShouldEqual, "test_db")
+		})
+
+		Convey("SELECT * should return the implicit time column first", func(ctx C) {
+			rows, err := db.Query("SELECT * FROM 'transcipt'")
+			So(err, ShouldBeNil)
+			defer rows.Close()
+			columns, err := rows.Columns()
+			So(err, ShouldBeNil)
+			So(columns, ShouldResemble, []string{"time", "id", "student_name", "score", "frame"})
+			count := 0
+			for rows.Next() {
+				var (
+					at    time.Time
+					id    int
+					name  string
+					score float64
+					frame []byte
+				)
+				So(rows.Scan(&at, &id, &name, &score, &frame), ShouldBeNil)
+				So(at.Equal(start.Add(time.Duration(count)*time.Minute)), ShouldBeTrue)
+				So(id, ShouldEqual, count)
+				So(frame, ShouldResemble, []byte{byte(count)})
+				count++
+			}
+			So(count, ShouldEqual, 10)
+		})
+
+		Convey("SELECT LAST * should return the latest row", func(ctx C) {
+			var (
+				at   time.Time
+				id   int
+				name string
+			)
+			So(db.QueryRow("SELECT LAST time, id, student_name FROM transcipt").Scan(&at, &id, &name), ShouldBeNil)
+			So(id, ShouldEqual, 9)
+			So(name, ShouldEqual, "s0")
+		})
+
+		Convey("WHERE time BETWEEN should filter the rows by time and other conditions", func(ctx C) {
+			rows, err := db.Query("select id from transcipt where time between ? and ? and student_name = ?",
+				start.Add(2*time.Minute), start.Add(8*time.Minute), "s1")
+			So(err, ShouldBeNil)
+			defer rows.Close()
+			var ids []int
+			for rows.Next() {
+				var id int
+				So(rows.Scan(&id), ShouldBeNil)
+				ids = append(ids, id)
+			}
+			So(ids, ShouldResemble, []int{4, 7})
+		})
+
+		Convey("String arguments with quotes and backslashes should be read back as they are", func(ctx C) {
+			name := `it's a \' or 1=1 -- \`
+			mustExec("INSERT INTO transcipt(id, student_name) VALUES(?, ?)", 30, name)
+			var got string
+			So(db.QueryRow("select student_name from transcipt where student_name = ?", name).Scan(&got), ShouldBeNil)
+			So(got, ShouldEqual, name)
+		})
+
+		Convey("A binary argument should be rejected and a nil one read back as NULL", func(ctx C) {
+			_, err := db.Exec("INSERT INTO transcipt(id, frame) VALUES(?, ?)", 20, []byte{0x1b})
+			So(err, ShouldEqual, rtdb.BinaryArgsUnsupported)
+			mustExec("INSERT INTO transcipt(id, frame) VALUES(?, ?)", 20, []byte(nil))
+			frame := []byte{0x1b}
+			So(db.QueryRow("select frame from transcipt where id = ?", 20).Scan(&frame), ShouldBeNil)
+			So(frame, ShouldBeNil)
+		})
+
+		Convey("A streaming query should not lose rows between chunks", func(ctx C) {
+			mustExec("CREATE TABLE IF NOT EXISTS 'boundary'(id int)")
+			for i, at := range []string{
+				"2021-01-01 00:59:59.500", "2021-01-01 01:00:00.000", "2021-01-01 01:59:59.999",
+				"2021-01-01 23:59:59.999", "2021-01-02 00:00:00.500", "2021-01-03 00:00:00.000",
+			} {
+				now, _ = time.Parse("2006-01-02 15:04:05.000", at)
+				mustExec("INSERT INTO 'boundary'(id) VALUES(?)", i)
+			}
+			count := func(window time.Duration, query string) int {
+				ctx := rtdb.WithStreaming(context.Background(), rtdb.StreamOptions{Window: window})
+				rows, err := db.QueryContext(ctx, query)
+				So(err, ShouldBeNil)
+				defer rows.Close()
+				n := 0
+				for rows.Next() {
+					n++
+				}
+				So(rows.Err(), ShouldBeNil)
+				return n
+			}
+			// second precision literals
+			So(count(time.Hour, "SELECT * FROM 'boundary' WHERE time BETWEEN '2021-01-01 00:00:00' AND '2021-01-01 02:00:00'"), ShouldEqual, 3)
+			// date only literals
+			So(count(24*time.Hour, "SELECT * FROM 'boundary' WHERE time BETWEEN '2021-01-01' AND '2021-01-03'"), ShouldEqual, 6)
+		})
+
+		Convey("Rows without a time value should get distinct times", func(ctx C) {
+			mustExec("INSERT INTO transcipt(id) VALUES(10), (11)")
+			var count int
+			rows, err := db.Query("select * from transcipt where time > ?", now)
+			So(err, ShouldBeNil)
+			for rows.Next() {
+				count++
+			}
+			So(rows.Close(), ShouldBeNil)
+			So(count, ShouldEqual, 2)
+		})
+
+		Convey("Unknown tables and columns should return errors", func(ctx C) {
+			_, err := db.Query("select * from missing")
+			So(errors.Is(err, rtdb.InvalidArgs), ShouldBeTrue)
+			_, err = db.Query("select missing from transcipt")
+			So(errors.Is(err, rtdb.InvalidArgs), ShouldBeTrue)
+		})
+	})
+}
+
+// go test -timeout 30s -run ^TestDriver$ github.com/racetopdb/gortdb/rtdbtest -v
+func TestDriver(t *testing.T) {
+	Convey("TestDriver", t, func(ctx C) {
+		Convey("Connections to the same address should share the engine", func(ctx C) {
+			dsn := "test:test@tcp(127.0.0.1:9999)/shared_db"
+			db1, err := sql.Open(DriverName, dsn)
+			So(err, ShouldBeNil)
+			defer db1.Close()
+			db2, err := sql.Open(DriverName, dsn)
+			So(err, ShouldBeNil)
+			defer db2.Close()
+
+			_, err = db1.Exec("CREATE DATABASE shared_db IF NOT EXISTS")
+			So(err, ShouldBeNil)
+			var name string
+			So(db2.QueryRow("SHOW DATABASES").Scan(&name), ShouldBeNil)
+			So(name, ShouldEqual, "shared_db")
+			Shared("127.0.0.1:9999").Reset()
+		})
+
+		Convey("The rtdb driver should use the emulator with the backend parameter", func(ctx C) {
+			db, err := sql.Open("rtdb", "test:test@tcp(127.0.0.1:9998)/?backend=rtdbtest")
+			So(err, ShouldBeNil)
+			defer db.Close()
+			_, err = db.Exec("CREATE DATABASE backend_db")
+			So(err, ShouldBeNil)
+			So(Shared("127.0.0.1:9998").databases, ShouldContainKey, "backend_db")
+			Shared("127.0.0.1:9998").Reset()
+		})
+
+		Convey("An empty password should be rejected like libtsdb does", func(ctx C) {
+			db, err := sql.Open(DriverName, "test:@tcp(127.0.0.1:9999)/")
+			So(err, ShouldBeNil)
+			defer db.Close()
+			So(db.Ping(), ShouldEqual, rtdb.InvalidArgs)
+		})
+	})
+}
+
+func mustConnector(d *rtdb.RtdbDriver, dsn string) driver.Connector {
+	c, err := d.OpenConnector(dsn)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}